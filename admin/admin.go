@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"net/http"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Require rejects users whose id isn't in uids, it must run after Authorize
+func Require(uids []string) gin.HandlerFunc {
+	admins := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		admins[uid] = true
+	}
+	return func(c *gin.Context) {
+		if !admins[c.GetString("uid")] {
+			apperror.Abort(c, apperror.Forbidden("admin only"))
+		}
+	}
+}
+
+// LogLevel represents body of get and change log level request
+type LogLevel struct {
+	Level string `json:"level" binding:"required,oneof=debug info warn error"`
+}
+
+// Handler represents handler of admin requests
+type Handler struct {
+	// LogLevel is the level of the running logger
+	LogLevel zap.AtomicLevel
+}
+
+// GetLogLevel handle get log level request
+func (h *Handler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevel{Level: h.LogLevel.Level().String()})
+}
+
+// SetLogLevel handle change log level request, the change lasts until
+// restart
+func (h *Handler) SetLogLevel(c *gin.Context) {
+	req := LogLevel{}
+	if err := validation.Bind(c, &req); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		apperror.Abort(c, apperror.BadRequest(err.Error()))
+		return
+	}
+
+	from := h.LogLevel.Level()
+	h.LogLevel.SetLevel(level)
+	logger.Extract(c).Warn("log level changed",
+		zap.String("from", from.String()),
+		zap.String("to", level.String()),
+		zap.String("uid", c.GetString("uid")),
+	)
+	c.JSON(http.StatusOK, LogLevel{Level: level.String()})
+}
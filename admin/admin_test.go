@@ -0,0 +1,57 @@
+package admin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/admin"
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func router(h *admin.Handler, uid string) *gin.Engine {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	g := r.Group("/admin", func(c *gin.Context) { c.Set("uid", uid) }, admin.Require([]string{"1"}))
+	g.GET("/log/level", h.GetLogLevel)
+	g.PUT("/log/level", h.SetLogLevel)
+	return r
+}
+
+func TestSetLogLevel(t *testing.T) {
+	h := &admin.Handler{LogLevel: zap.NewAtomicLevelAt(zap.InfoLevel)}
+	r := router(h, "1")
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/log/level", strings.NewReader(`{"level":"debug"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Error("status code is not ok", rec.Code, rec.Body.String())
+	}
+	if h.LogLevel.Level() != zap.DebugLevel {
+		t.Error("want level debug but get", h.LogLevel.Level())
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/admin/log/level", strings.NewReader(`{"level":"loud"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Error("given level loud want status", http.StatusUnprocessableEntity, "but get", rec.Code)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	h := &admin.Handler{LogLevel: zap.NewAtomicLevelAt(zap.InfoLevel)}
+	rec := httptest.NewRecorder()
+	router(h, "2").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/log/level", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Error("given non admin want status", http.StatusForbidden, "but get", rec.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package apiversion
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const key = "api_version"
+
+// Use marks requests of a route group with api version n
+func Use(n int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(key, n)
+	}
+}
+
+// Get returns the api version of the request, 1 for routes outside any
+// versioned group
+func Get(c *gin.Context) int {
+	if n := c.GetInt(key); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Deprecation describes the retirement of a route group
+type Deprecation struct {
+	// At is when the group was deprecated, zero leaves it undeprecated
+	At time.Time
+	// Sunset is when the group stops being served, zero when undecided
+	Sunset time.Time
+	// Successor is the prefix of the group replacing it
+	Successor string
+}
+
+// Deprecated sets the Deprecation, Sunset and successor Link headers of
+// RFC 9745 and RFC 8594 on every response of the group at prefix
+func Deprecated(prefix string, d Deprecation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d.At.IsZero() {
+			return
+		}
+		c.Header("Deprecation", "@"+strconv.FormatInt(d.At.Unix(), 10))
+		if !d.Sunset.IsZero() {
+			c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Successor != "" {
+			successor := d.Successor + strings.TrimPrefix(c.Request.URL.Path, prefix)
+			c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package apiversion_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apiversion"
+	"github.com/gin-gonic/gin"
+)
+
+func TestVersions(t *testing.T) {
+	deprecation := apiversion.Deprecation{
+		At:        time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+		Successor: "/v2",
+	}
+	version := func(c *gin.Context) {
+		c.String(http.StatusOK, strconv.Itoa(apiversion.Get(c)))
+	}
+
+	r := gin.New()
+	r.Group("", apiversion.Deprecated("", deprecation)).GET("/users/:uid", version)
+	r.Group("/v1", apiversion.Use(1), apiversion.Deprecated("/v1", deprecation)).GET("/users/:uid", version)
+	r.Group("/v2", apiversion.Use(2)).GET("/users/:uid", version)
+
+	tests := []struct {
+		path       string
+		version    string
+		deprecated bool
+	}{
+		{"/users/3", "1", true},
+		{"/v1/users/3", "1", true},
+		{"/v2/users/3", "2", false},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if rec.Body.String() != test.version {
+			t.Error("given", test.path, "want version", test.version, "but get", rec.Body.String())
+		}
+		if !test.deprecated {
+			if rec.Header().Get("Deprecation") != "" {
+				t.Error("given", test.path, "want no Deprecation header but get", rec.Header().Get("Deprecation"))
+			}
+			continue
+		}
+
+		if get := rec.Header().Get("Deprecation"); get != "@1792368000" {
+			t.Error("given", test.path, "want Deprecation @1792368000 but get", get)
+		}
+		if get := rec.Header().Get("Sunset"); get != "Fri, 30 Apr 2027 00:00:00 GMT" {
+			t.Error("given", test.path, "want Sunset Fri, 30 Apr 2027 00:00:00 GMT but get", get)
+		}
+		if get := rec.Header().Get("Link"); get != `</v2/users/3>; rel="successor-version"` {
+			t.Error("given", test.path, "want successor link to /v2/users/3 but get", get)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package apperror
+
+import (
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Code is the machine-readable kind of an error
+type Code string
+
+// error codes
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeConflict             Code = "conflict"
+	CodeGone                 Code = "gone"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodePreconditionRequired Code = "precondition_required"
+	CodeValidation           Code = "validation_failed"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeTooManyRequests      Code = "too_many_requests"
+	CodeInternal             Code = "internal"
+	CodeUnavailable          Code = "unavailable"
+	CodeBadGateway           Code = "bad_gateway"
+)
+
+var statuses = map[Code]int{
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodeNotFound:             http.StatusNotFound,
+	CodeConflict:             http.StatusConflict,
+	CodeGone:                 http.StatusGone,
+	CodePreconditionFailed:   http.StatusPreconditionFailed,
+	CodePreconditionRequired: http.StatusPreconditionRequired,
+	CodeValidation:           http.StatusUnprocessableEntity,
+	CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	CodeTooManyRequests:      http.StatusTooManyRequests,
+	CodeInternal:             http.StatusInternalServerError,
+	CodeUnavailable:          http.StatusServiceUnavailable,
+	CodeBadGateway:           http.StatusBadGateway,
+}
+
+// FieldError describes why a request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error represents an error safe to show to clients, the underlying cause
+// is only ever logged
+type Error struct {
+	Code    Code
+	Message string
+	Cause   error
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Status returns the http status of the error
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// New creates error with code and client message
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap creates error with code and client message caused by err
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Cause: err}
+}
+
+// BadRequest creates bad request error
+func BadRequest(message string) *Error {
+	return New(CodeBadRequest, message)
+}
+
+// Unauthorized creates error for missing or invalid credentials
+func Unauthorized(message string) *Error {
+	return New(CodeUnauthorized, message)
+}
+
+// Forbidden creates error for authenticated user lacking permission
+func Forbidden(message string) *Error {
+	return New(CodeForbidden, message)
+}
+
+// NotFound creates not found error
+func NotFound(message string) *Error {
+	return New(CodeNotFound, message)
+}
+
+// Gone creates error for resource no longer available
+func Gone(message string) *Error {
+	return New(CodeGone, message)
+}
+
+// Validation creates error listing every invalid field
+func Validation(fields ...FieldError) *Error {
+	return &Error{Code: CodeValidation, Message: "request is invalid", Fields: fields}
+}
+
+// Internal wraps unexpected error, its details never reach the client
+func Internal(err error) *Error {
+	return Wrap(err, CodeInternal, "internal server error")
+}
+
+// Unavailable wraps failure of a dependency like redis
+func Unavailable(err error) *Error {
+	return Wrap(err, CodeUnavailable, "service temporarily unavailable")
+}
+
+// From converts any error into *Error, known library errors get their
+// matching code and anything else is internal
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Wrap(err, CodeNotFound, "record not found")
+	}
+	return Internal(err)
+}
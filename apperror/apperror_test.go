@@ -0,0 +1,82 @@
+package apperror_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func serve(handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.GET("/things/:id", handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		given      error
+		wantStatus int
+		wantCode   apperror.Code
+		wantDetail string
+	}{
+		{apperror.NotFound("post not found"), http.StatusNotFound, apperror.CodeNotFound, "post not found"},
+		{apperror.Forbidden("unauthorized user"), http.StatusForbidden, apperror.CodeForbidden, "unauthorized user"},
+		{gorm.ErrRecordNotFound, http.StatusNotFound, apperror.CodeNotFound, "record not found"},
+		{errors.New("mssql: Invalid column name 'secret'"), http.StatusInternalServerError, apperror.CodeInternal, "internal server error"},
+		{apperror.Unavailable(errors.New("dial tcp 10.0.0.1:6379: connection refused")), http.StatusServiceUnavailable, apperror.CodeUnavailable, "service temporarily unavailable"},
+	}
+
+	for _, tt := range tests {
+		rec := serve(func(c *gin.Context) {
+			apperror.Abort(c, tt.given)
+		})
+
+		if rec.Code != tt.wantStatus {
+			t.Error("given", tt.given, "want status", tt.wantStatus, "but get", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Error("given", tt.given, "want content type application/problem+json but get", ct)
+		}
+
+		problem := apperror.Problem{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Error("can't unmarshal response", rec.Body.String())
+			continue
+		}
+		if problem.Code != tt.wantCode {
+			t.Error("given", tt.given, "want code", tt.wantCode, "but get", problem.Code)
+		}
+		if problem.Detail != tt.wantDetail {
+			t.Error("given", tt.given, "want detail", tt.wantDetail, "but get", problem.Detail)
+		}
+		if problem.Instance != "/things/1" {
+			t.Error("given", tt.given, "want instance /things/1 but get", problem.Instance)
+		}
+		if strings.Contains(rec.Body.String(), "mssql") || strings.Contains(rec.Body.String(), "6379") {
+			t.Error("given", tt.given, "internal details leaked", rec.Body.String())
+		}
+	}
+}
+
+func TestMiddlewareKeepsWrittenResponse(t *testing.T) {
+	rec := serve(func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/elsewhere")
+		c.Error(errors.New("logged only"))
+	})
+
+	if rec.Code != http.StatusFound {
+		t.Error("want status", http.StatusFound, "but get", rec.Code)
+	}
+}
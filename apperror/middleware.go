@@ -0,0 +1,62 @@
+package apperror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Problem represents RFC 7807 problem details
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     Code         `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Abort records err for Middleware to render and stops the handler chain
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// Middleware renders the last error recorded by handlers as
+// application/problem+json, logging its internal cause
+func Middleware(c *gin.Context) {
+	c.Next()
+
+	if len(c.Errors) == 0 {
+		return
+	}
+	e := From(c.Errors.Last().Err)
+	status := e.Status()
+
+	l := logger.Extract(c)
+	if status >= http.StatusInternalServerError {
+		l.Error("request failed", zap.String("code", string(e.Code)), zap.Error(e))
+	} else if e.Cause != nil {
+		l.Info("request rejected", zap.String("code", string(e.Code)), zap.Error(e))
+	}
+
+	// the handler already answered, e.g. with a redirect
+	if c.Writer.Written() {
+		return
+	}
+
+	body, _ := json.Marshal(Problem{
+		Type:     "/problems/" + string(e.Code),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Message,
+		Instance: c.Request.URL.Path,
+		Code:     e.Code,
+		Errors:   e.Fields,
+	})
+	c.Data(status, "application/problem+json", body)
+}
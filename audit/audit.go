@@ -0,0 +1,335 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"example.com/social-gin/logger"
+	"example.com/social-gin/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrAppendOnly is returned when an audit entry would be changed or deleted
+var ErrAppendOnly = errors.New("audit entries are append-only")
+
+// Entry represents an audited action. Every entry holds the hash of the one
+// before it, so changing or removing an entry breaks the chain after it.
+type Entry struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	// Actor is the uid of the user acting, empty when unauthenticated
+	Actor     string `gorm:"index;size:64" json:"actor"`
+	Action    string `gorm:"index;size:64" json:"action"`
+	Target    string `gorm:"index;size:255" json:"target"`
+	Detail    string `gorm:"size:255" json:"detail,omitempty"`
+	Changes   string `json:"changes,omitempty"`
+	IP        string `gorm:"size:64" json:"ip"`
+	RequestID string `gorm:"size:64" json:"request_id"`
+	PrevHash  string `gorm:"size:64" json:"prev_hash"`
+	Hash      string `gorm:"size:64;uniqueIndex" json:"hash"`
+}
+
+// TableName keeps audit entries apart from the other tables
+func (Entry) TableName() string {
+	return "audit_entries"
+}
+
+// BeforeUpdate refuses to change an entry
+func (Entry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// BeforeDelete refuses to delete an entry
+func (Entry) BeforeDelete(tx *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// Sum computes the hash of the entry chained to its PrevHash
+func (e Entry) Sum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%q\n%q\n%q\n%q\n%q\n%q\n%q",
+		e.PrevHash, e.CreatedAt.UnixNano(), e.Actor, e.Action, e.Target, e.Detail, e.Changes, e.IP, e.RequestID)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Check walks entries in id order and returns the id of the first entry
+// whose hash or link to the previous entry doesn't match
+func Check(prevHash string, entries []Entry) (uint, bool) {
+	for _, e := range entries {
+		if e.PrevHash != prevHash || e.Sum() != e.Hash {
+			return e.ID, false
+		}
+		prevHash = e.Hash
+	}
+	return 0, true
+}
+
+// redactor hides secret fields in diffs, only recording they changed
+var redactor, _ = logger.NewRedactor(nil, nil, nil)
+
+// Diff returns the json fields that differ between before and after as
+// field: [before, after], either may be nil for creates and deletes
+func Diff(before, after interface{}) map[string][2]interface{} {
+	b, a := fields(before), fields(after)
+	diff := map[string][2]interface{}{}
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			diff[k] = [2]interface{}{v, a[k]}
+		}
+	}
+	for k, v := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = [2]interface{}{nil, v}
+		}
+	}
+	for k, v := range diff {
+		if redactor.Field(k) {
+			diff[k] = [2]interface{}{redacted(v[0]), redacted(v[1])}
+		}
+	}
+	return diff
+}
+
+func redacted(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return logger.Redacted
+}
+
+func fields(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(b, &m)
+	return m
+}
+
+// deniedQueue bounds the denied requests waiting to be recorded
+const deniedQueue = 100
+
+// Trail appends audit entries and serves them to admins
+type Trail struct {
+	DB *gorm.DB
+	// DeniedPerMinute bounds the denied requests recorded each minute, so
+	// clients without credentials can't load the database through the
+	// trail. Those over it are only counted in the log. 60 when zero.
+	DeniedPerMinute int
+
+	mu sync.Mutex
+
+	denied   chan Entry
+	deniedMu sync.Mutex
+	window   time.Time
+	recorded int
+	dropped  int
+}
+
+// Event describes an audited action
+type Event struct {
+	// Actor is the uid acting, the authenticated user when empty
+	Actor  string
+	Action string
+	Target string
+	// Detail says why, like the reason access was denied
+	Detail string
+	// Before and After are the target before and after the action, their
+	// differing json fields are recorded
+	Before interface{}
+	After  interface{}
+}
+
+// Record appends an entry of ev, along with the ip and request id of c.
+// It's recorded after the action succeeded, a failure is logged and doesn't
+// fail the request.
+func (t *Trail) Record(c *gin.Context, ev Event) {
+	if t == nil || t.DB == nil {
+		return
+	}
+	e := entry(c, ev)
+	if err := t.record(c.Request.Context(), &e, ev); err != nil {
+		logger.Extract(c).Error("audit record failed", zap.String("action", e.Action), zap.String("target", e.Target), zap.Error(err))
+	}
+}
+
+// RecordDenied queues an entry of ev, a request refused before anyone was
+// authenticated. It never waits on the database, past DeniedPerMinute or
+// when the queue is full the entry is dropped. Nothing is recorded until
+// Start runs.
+func (t *Trail) RecordDenied(c *gin.Context, ev Event) {
+	if t == nil || t.DB == nil || t.denied == nil {
+		return
+	}
+	if !t.allow() {
+		return
+	}
+	e := entry(c, ev)
+	e.fit()
+	select {
+	case t.denied <- e:
+	default:
+		t.deniedMu.Lock()
+		t.dropped++
+		t.deniedMu.Unlock()
+	}
+}
+
+// allow tells whether another denied request fits in this minute
+func (t *Trail) allow() bool {
+	limit := t.DeniedPerMinute
+	if limit == 0 {
+		limit = 60
+	}
+
+	t.deniedMu.Lock()
+	defer t.deniedMu.Unlock()
+	if now := time.Now(); now.Sub(t.window) >= time.Minute {
+		if t.dropped > 0 {
+			zap.L().Warn("audit denied requests dropped", zap.Int("count", t.dropped), zap.Time("since", t.window))
+		}
+		t.window, t.recorded, t.dropped = now, 0, 0
+	}
+	if t.recorded >= limit {
+		t.dropped++
+		return false
+	}
+	t.recorded++
+	return true
+}
+
+// Start records the denied requests queued by RecordDenied until ctx is
+// done, the returned channel is closed once the entry in progress is in
+func (t *Trail) Start(ctx context.Context, logger *zap.Logger) <-chan struct{} {
+	t.denied = make(chan Entry, deniedQueue)
+	done := make(chan struct{})
+	l := logger.With(zap.String("worker", "audit"))
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-t.denied:
+				if err := t.append(t.DB.WithContext(ctx), &e); err != nil {
+					l.Error("audit record failed", zap.String("action", e.Action), zap.String("target", e.Target), zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// entry returns the entry of ev, along with the ip and request id of c
+func entry(c *gin.Context, ev Event) Entry {
+	e := Entry{
+		Actor:     ev.Actor,
+		Action:    ev.Action,
+		Target:    ev.Target,
+		Detail:    ev.Detail,
+		IP:        c.ClientIP(),
+		RequestID: requestid.FromContext(c.Request.Context()),
+	}
+	if e.Actor == "" {
+		e.Actor = c.GetString("uid")
+	}
+	return e
+}
+
+// System is the actor of actions the server takes on its own
+const System = "system"
+
+// RecordSystem appends an entry of ev taken by the server itself, like a
+// config reload, outside of any request
+func (t *Trail) RecordSystem(ctx context.Context, ev Event) {
+	if t == nil || t.DB == nil {
+		return
+	}
+	e := Entry{
+		Actor:  System,
+		Action: ev.Action,
+		Target: ev.Target,
+		Detail: ev.Detail,
+	}
+	if err := t.record(ctx, &e, ev); err != nil {
+		zap.L().Error("audit record failed", zap.String("action", e.Action), zap.String("target", e.Target), zap.Error(err))
+	}
+}
+
+// record adds the changes of ev to e and appends it
+func (t *Trail) record(ctx context.Context, e *Entry, ev Event) error {
+	e.fit()
+	if ev.Before != nil || ev.After != nil {
+		if diff := Diff(ev.Before, ev.After); len(diff) > 0 {
+			b, _ := json.Marshal(diff)
+			e.Changes = string(b)
+		}
+	}
+	return t.append(t.DB.WithContext(ctx), e)
+}
+
+// append links e to the last entry. The last entry is locked until e is
+// inserted so concurrent appends, from other instances too, form one chain.
+func (t *Trail) append(db *gorm.DB, e *Entry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		last := Entry{}
+		if err := lastEntry(tx, &last); err != nil {
+			return err
+		}
+		e.PrevHash = last.Hash
+		// stored with microseconds so the hash still matches once read back
+		e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		e.Hash = e.Sum()
+		return tx.Create(e).Error
+	})
+}
+
+// lastEntry reads the last entry, locked until tx ends. sqlite has no row
+// locks, it runs one write transaction at a time anyway.
+func lastEntry(tx *gorm.DB, last *Entry) error {
+	if tx.Dialector.Name() != "sqlserver" {
+		return tx.Order("id desc").Limit(1).Find(last).Error
+	}
+	return tx.Raw("SELECT TOP 1 * FROM audit_entries WITH (UPDLOCK, HOLDLOCK) ORDER BY id DESC").Scan(last).Error
+}
+
+// fit cuts the fields of e to their columns, targets and details may carry
+// whatever a client sent
+func (e *Entry) fit() {
+	e.Actor = bound(e.Actor, 64)
+	e.Action = bound(e.Action, 64)
+	e.Target = bound(e.Target, 255)
+	e.Detail = bound(e.Detail, 255)
+	e.IP = bound(e.IP, 64)
+	e.RequestID = bound(e.RequestID, 64)
+}
+
+// bound cuts s to at most n bytes without splitting a character
+func bound(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
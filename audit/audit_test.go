@@ -0,0 +1,161 @@
+package audit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"example.com/social-gin/audit"
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// trail appends to a sqlite database
+func trail(t *testing.T) *audit.Trail {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&audit.Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	return &audit.Trail{DB: db}
+}
+
+// request returns the context of a request by user uid, anonymous when empty
+func request(uid string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if uid != "" {
+		c.Set("uid", uid)
+	}
+	return c
+}
+
+func entries(tr *audit.Trail) []audit.Entry {
+	entries := []audit.Entry{}
+	tr.DB.Order("id").Find(&entries)
+	return entries
+}
+
+func chain(n int) []audit.Entry {
+	entries := make([]audit.Entry, 0, n)
+	prevHash := ""
+	for i := 1; i <= n; i++ {
+		e := audit.Entry{
+			ID:        uint(i),
+			CreatedAt: time.Unix(int64(i), 0),
+			Actor:     "1",
+			Action:    "post.create",
+			Target:    "users/1/posts/" + strconv.Itoa(i),
+			PrevHash:  prevHash,
+		}
+		e.Hash = e.Sum()
+		prevHash = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestCheck(t *testing.T) {
+	entries := chain(3)
+	if id, ok := audit.Check("", entries); !ok {
+		t.Error("given untouched chain want valid but get broken at", id)
+	}
+
+	tampered := chain(3)
+	tampered[1].Actor = "2"
+	if id, ok := audit.Check("", tampered); ok || id != 2 {
+		t.Error("given changed entry 2 want broken at 2 but get", id, ok)
+	}
+
+	removed := append(chain(3)[:1:1], chain(3)[2])
+	if id, ok := audit.Check("", removed); ok || id != 3 {
+		t.Error("given removed entry 2 want broken at 3 but get", id, ok)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	type user struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	before := user{Name: "a", Password: "old", Email: "a@example.com"}
+	after := user{Name: "b", Password: "new", Email: "a@example.com"}
+
+	diff := audit.Diff(before, after)
+	if len(diff) != 2 {
+		t.Error("given name and password changed want 2 changes but get", diff)
+	}
+	if diff["name"] != [2]interface{}{"a", "b"} {
+		t.Error("want name change [a b] but get", diff["name"])
+	}
+	if diff["password"] != [2]interface{}{logger.Redacted, logger.Redacted} {
+		t.Error("want password redacted but get", diff["password"])
+	}
+
+	diff = audit.Diff(nil, after)
+	if diff["email"] != [2]interface{}{nil, "a@example.com"} {
+		t.Error("given create want email [nil a@example.com] but get", diff["email"])
+	}
+}
+
+func TestRecord(t *testing.T) {
+	tr := trail(t)
+	tr.Record(request("1"), audit.Event{Action: "post.create", Target: "users/1/posts/1"})
+	tr.Record(request(""), audit.Event{
+		Action: "user.login_failed",
+		Target: "users?username=" + strings.Repeat("é", 200),
+	})
+	tr.RecordSystem(context.Background(), audit.Event{Action: "config.reload", Target: "config.yaml"})
+
+	got := entries(tr)
+	if len(got) != 3 {
+		t.Fatal("want 3 entries but get", len(got))
+	}
+	if id, ok := audit.Check("", got); !ok {
+		t.Error("given appended entries want valid chain but get broken at", id)
+	}
+	if got[0].Actor != "1" || got[2].Actor != audit.System {
+		t.Error("want actors 1 and system but get", got[0].Actor, got[2].Actor)
+	}
+	if target := got[1].Target; len(target) > 255 || !utf8.ValidString(target) {
+		t.Error("given long target want it cut to 255 bytes but get", len(target), "bytes")
+	}
+}
+
+func TestRecordDenied(t *testing.T) {
+	tr := trail(t)
+	tr.DeniedPerMinute = 2
+	tr.RecordDenied(request(""), audit.Event{Action: "auth.denied"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := tr.Start(ctx, zap.NewNop())
+	defer func() {
+		cancel()
+		<-done
+	}()
+	for i := 0; i < 5; i++ {
+		tr.RecordDenied(request(""), audit.Event{Action: "auth.denied", Target: "GET /me"})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(entries(tr)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(entries(tr)); n != 2 {
+		t.Error("given 5 denials with 2 a minute and one before start want 2 recorded but get", n)
+	}
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+// maxLimit bounds the entries listed at once
+const maxLimit = 500
+
+// Verification represents result of verify audit trail request
+type Verification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenAt is the first entry not matching the chain
+	BrokenAt uint `json:"broken_at,omitempty"`
+}
+
+// ListEntry handle list audit entries request, filtered by actor, action,
+// target, since and until, newest first. before pages through older entries.
+func (t *Trail) ListEntry(c *gin.Context) {
+	query := t.DB.WithContext(c.Request.Context()).Order("id desc")
+	for _, column := range []string{"actor", "action", "target"} {
+		if v := c.Query(column); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+	for param, op := range map[string]string{"since": ">=", "until": "<"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			apperror.Abort(c, apperror.BadRequest(param+" must be an RFC 3339 time"))
+			return
+		}
+		query = query.Where("created_at "+op+" ?", at)
+	}
+	if v := c.Query("before"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			apperror.Abort(c, apperror.BadRequest("before must be an entry id"))
+			return
+		}
+		query = query.Where("id < ?", id)
+	}
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			apperror.Abort(c, apperror.BadRequest("limit must be between 1 and "+strconv.Itoa(maxLimit)))
+			return
+		}
+		limit = n
+	}
+
+	entries := []Entry{}
+	if err := query.Limit(limit).Find(&entries).Error; err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// Verify handle verify audit trail request, rehashing the whole chain
+func (t *Trail) Verify(c *gin.Context) {
+	db := t.DB.WithContext(c.Request.Context())
+	v := Verification{Valid: true}
+	prevHash := ""
+	var lastID uint
+	for {
+		entries := []Entry{}
+		if err := db.Where("id > ?", lastID).Order("id").Limit(maxLimit).Find(&entries).Error; err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		if len(entries) == 0 {
+			break
+		}
+		if id, ok := Check(prevHash, entries); !ok {
+			v.Valid = false
+			v.BrokenAt = id
+			break
+		}
+		v.Checked += len(entries)
+		last := entries[len(entries)-1]
+		prevHash, lastID = last.Hash, last.ID
+	}
+	c.JSON(http.StatusOK, v)
+}
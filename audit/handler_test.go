@@ -0,0 +1,75 @@
+package audit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"github.com/gin-gonic/gin"
+)
+
+func admin(tr *audit.Trail) *gin.Engine {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.GET("/admin/audit", tr.ListEntry)
+	r.GET("/admin/audit/verify", tr.Verify)
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestListEntry(t *testing.T) {
+	tr := trail(t)
+	r := admin(tr)
+	for _, action := range []string{"post.create", "post.update", "post.create"} {
+		tr.Record(request("1"), audit.Event{Action: action, Target: "users/1/posts/1"})
+	}
+
+	listed := []audit.Entry{}
+	rec := get(r, "/admin/audit?action=post.create")
+	json.Unmarshal(rec.Body.Bytes(), &listed)
+	if rec.Code != http.StatusOK || len(listed) != 2 || listed[0].ID != 3 {
+		t.Error("given action filter want entries 3 and 1 but get", rec.Code, listed)
+	}
+
+	listed = []audit.Entry{}
+	json.Unmarshal(get(r, "/admin/audit?before=3&limit=1").Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].ID != 2 {
+		t.Error("given before 3 and limit 1 want entry 2 but get", listed)
+	}
+
+	for _, query := range []string{"limit=0", "limit=501", "before=x", "since=yesterday"} {
+		if rec := get(r, "/admin/audit?"+query); rec.Code != http.StatusBadRequest {
+			t.Error("given", query, "want 400 but get", rec.Code)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tr := trail(t)
+	r := admin(tr)
+	for i := 0; i < 3; i++ {
+		tr.Record(request("1"), audit.Event{Action: "post.create", Target: "users/1/posts/1"})
+	}
+
+	v := audit.Verification{}
+	json.Unmarshal(get(r, "/admin/audit/verify").Body.Bytes(), &v)
+	if !v.Valid || v.Checked != 3 {
+		t.Error("given untouched trail want 3 valid entries but get", v)
+	}
+
+	// written around the model, which refuses updates
+	tr.DB.Exec("UPDATE audit_entries SET actor = '2' WHERE id = 2")
+	v = audit.Verification{}
+	json.Unmarshal(get(r, "/admin/audit/verify").Body.Bytes(), &v)
+	if v.Valid || v.BrokenAt != 2 {
+		t.Error("given changed entry 2 want broken at 2 but get", v)
+	}
+}
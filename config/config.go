@@ -0,0 +1,512 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"example.com/social-gin/cors"
+	"example.com/social-gin/csrf"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/secure"
+	"example.com/social-gin/server"
+	"example.com/social-gin/user"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Config is the whole configuration of the server
+type Config struct {
+	// File is the config file read, empty when there was none
+	File string `mapstructure:"-"`
+
+	Server server.Options `mapstructure:"server"`
+	// DSN holds the database credentials, it has no default
+	DSN   string `mapstructure:"dsn" validate:"required"`
+	Redis Redis  `mapstructure:"redis"`
+
+	Login struct {
+		TokenTTL time.Duration `mapstructure:"token_ttl" validate:"gt=0"`
+	} `mapstructure:"login"`
+	OAuth struct {
+		TokenTTL time.Duration `mapstructure:"token_ttl" validate:"gt=0"`
+	} `mapstructure:"oauth"`
+	SoftDelete struct {
+		// Grace is how long deleted rows can be restored, zero means forever
+		Grace         time.Duration `mapstructure:"grace" validate:"gte=0"`
+		Retention     time.Duration `mapstructure:"retention" validate:"gt=0"`
+		PurgeInterval time.Duration `mapstructure:"purge_interval" validate:"gt=0"`
+	} `mapstructure:"softdelete"`
+	Export struct {
+		Dir string        `mapstructure:"dir" validate:"required"`
+		TTL time.Duration `mapstructure:"ttl" validate:"gt=0"`
+	} `mapstructure:"export"`
+	ETag struct {
+		RequireIfMatch bool `mapstructure:"require_if_match"`
+	} `mapstructure:"etag"`
+	Idempotency struct {
+		TTL time.Duration `mapstructure:"ttl" validate:"gt=0"`
+		// LockTTL is how long a request in progress holds its key
+		LockTTL time.Duration `mapstructure:"lock_ttl" validate:"gt=0"`
+	} `mapstructure:"idempotency"`
+	Health struct {
+		Timeout   time.Duration `mapstructure:"timeout" validate:"gt=0"`
+		PoolRatio float64       `mapstructure:"pool_ratio" validate:"gt=0,lte=1"`
+		// Drain is how long to wait between failing readiness and shutdown
+		Drain time.Duration `mapstructure:"drain" validate:"gte=0"`
+	} `mapstructure:"health"`
+	Shutdown struct {
+		// Timeout bounds the whole shutdown
+		Timeout time.Duration `mapstructure:"timeout" validate:"gt=0"`
+		// StopTimeout bounds stopping each component, http gets
+		// health.drain on top
+		StopTimeout time.Duration `mapstructure:"stop_timeout" validate:"gt=0"`
+		// Timeouts override the timeout of components by name: http,
+		// certificate, export-cleanup, export, purge, tracing, redis, sql
+		Timeouts map[string]time.Duration `mapstructure:"timeouts"`
+	} `mapstructure:"shutdown"`
+	CORS     cors.Config   `mapstructure:"cors"`
+	Security secure.Config `mapstructure:"security"`
+	CSRF     csrf.Config   `mapstructure:"csrf"`
+	Session  user.Session  `mapstructure:"session"`
+	Log      Log           `mapstructure:"log"`
+	Tracing  Tracing       `mapstructure:"tracing"`
+	API      struct {
+		V1 struct {
+			// Deprecation and Sunset are sent on v1 responses once set
+			Deprecation time.Time `mapstructure:"deprecation"`
+			Sunset      time.Time `mapstructure:"sunset" validate:"omitempty,gtfield=Deprecation"`
+		} `mapstructure:"v1"`
+	} `mapstructure:"api"`
+	RateLimit RateLimit `mapstructure:"ratelimit"`
+	Admin     struct {
+		// Users are the ids of the admins
+		Users []string `mapstructure:"users"`
+	} `mapstructure:"admin"`
+	// OIDC are the identity providers by name
+	OIDC map[string]oidc.Config `mapstructure:"oidc" validate:"dive"`
+}
+
+// Redis configures the redis connection
+type Redis struct {
+	Addr     string `mapstructure:"addr" validate:"required,hostname_port"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db" validate:"gte=0"`
+}
+
+// Log configures the logger and the request log
+type Log struct {
+	logger.Options `mapstructure:",squash"`
+	// Skip are routes not logged
+	Skip []string `mapstructure:"skip"`
+	// Routes override the level per route
+	Routes []logger.RouteLevel `mapstructure:"routes" validate:"dive"`
+	Body   logger.Body         `mapstructure:"body"`
+	// Redact hides these on top of the defaults
+	Redact struct {
+		Fields   []string `mapstructure:"fields"`
+		Headers  []string `mapstructure:"headers"`
+		Patterns []string `mapstructure:"patterns"`
+	} `mapstructure:"redact"`
+}
+
+// Tracing configures where traces are exported
+type Tracing struct {
+	Exporter    string  `mapstructure:"exporter" validate:"oneof=none stdout otlp"`
+	Endpoint    string  `mapstructure:"endpoint" validate:"required_if=Exporter otlp,omitempty,url"`
+	SampleRatio float64 `mapstructure:"sample_ratio" validate:"gte=0,lte=1"`
+}
+
+// Limit is a number of requests allowed per window
+type Limit struct {
+	Limit  int           `mapstructure:"limit" validate:"gt=0"`
+	Window time.Duration `mapstructure:"window" validate:"gt=0"`
+}
+
+// RateLimit configures the global limit and the stricter ones
+type RateLimit struct {
+	Limit `mapstructure:",squash"`
+	Login Limit `mapstructure:"login"`
+	User  Limit `mapstructure:"user"`
+}
+
+// defaults lists every key, env variables are only read for known keys
+var defaults = map[string]interface{}{
+	"server.addr":                      ":8080",
+	"server.read_header_timeout":       5 * time.Second,
+	"server.read_timeout":              30 * time.Second,
+	"server.write_timeout":             time.Minute,
+	"server.idle_timeout":              2 * time.Minute,
+	"server.max_header_bytes":          1 << 20,
+	"server.tls.cert_file":             "",
+	"server.tls.key_file":              "",
+	"server.tls.min_version":           "1.2",
+	"server.tls.client_ca_file":        "",
+	"server.tls.client_auth":           "",
+	"dsn":                              "",
+	"redis.addr":                       "localhost:6379",
+	"redis.password":                   "",
+	"redis.db":                         0,
+	"login.token_ttl":                  10 * time.Minute,
+	"oauth.token_ttl":                  time.Hour,
+	"softdelete.grace":                 7 * 24 * time.Hour,
+	"softdelete.retention":             30 * 24 * time.Hour,
+	"softdelete.purge_interval":        time.Hour,
+	"export.dir":                       "exports",
+	"export.ttl":                       24 * time.Hour,
+	"etag.require_if_match":            false,
+	"idempotency.ttl":                  24 * time.Hour,
+	"idempotency.lock_ttl":             time.Minute,
+	"health.timeout":                   time.Second,
+	"health.pool_ratio":                0.9,
+	"health.drain":                     0,
+	"shutdown.timeout":                 30 * time.Second,
+	"shutdown.stop_timeout":            10 * time.Second,
+	"shutdown.timeouts":                map[string]interface{}{},
+	"cors.allow_origins":               []string{},
+	"cors.allow_methods":               []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+	"cors.allow_headers":               []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "X-Request-ID", "X-CSRF-Token"},
+	"cors.expose_headers":              []string{"ETag", "Location", "Link", "Retry-After", "Deprecation", "Sunset", "Idempotent-Replayed", "X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
+	"cors.allow_credentials":           false,
+	"cors.max_age":                     10 * time.Minute,
+	"security.hsts":                    365 * 24 * time.Hour,
+	"security.hsts_include_subdomains": false,
+	"security.content_security_policy": "",
+	"security.frame_options":           "",
+	"security.referrer_policy":         "",
+	"csrf.enabled":                     false,
+	"csrf.cookie_name":                 "",
+	"csrf.header_name":                 "",
+	"csrf.session_cookie":              "session",
+	"csrf.secure":                      false,
+	"session.cookie_name":              "session",
+	"session.ttl":                      0,
+	"session.max_age":                  24 * time.Hour,
+	"session.secure":                   true,
+	"session.same_site":                "lax",
+	"log.level":                        "info",
+	"log.format":                       "json",
+	"log.sampling.initial":             0,
+	"log.sampling.thereafter":          0,
+	"log.skip":                         []string{"/healthz", "/readyz", "/metrics"},
+	"log.body.enabled":                 false,
+	"log.body.max_bytes":               4096,
+	"log.redact.fields":                []string{},
+	"log.redact.headers":               []string{},
+	"log.redact.patterns":              []string{},
+	"tracing.exporter":                 "none",
+	"tracing.endpoint":                 "http://localhost:4318/v1/traces",
+	"tracing.sample_ratio":             1.0,
+	"api.v1.deprecation":               time.Time{},
+	"api.v1.sunset":                    time.Time{},
+	"ratelimit.limit":                  300,
+	"ratelimit.window":                 time.Minute,
+	"ratelimit.login.limit":            10,
+	"ratelimit.login.window":           time.Minute,
+	"ratelimit.user.limit":             60,
+	"ratelimit.user.window":            time.Minute,
+	"admin.users":                      []string{},
+}
+
+// secrets can be read from the file named by <key>_file instead, like a
+// mounted docker or kubernetes secret. Client secrets of identity providers
+// are added per provider.
+var secrets = []string{"dsn", "redis.password"}
+
+// Source is the config read at startup, part of which reloads when the
+// config file changes
+type Source struct {
+	v       *viper.Viper
+	mu      sync.Mutex
+	current atomic.Value
+}
+
+// Load reads the config from defaults, the config file, env and the flags
+// in args, each overriding the one before. The file is --config or CONFIG,
+// config.yaml in the working directory or /etc/social-gin otherwise. Env
+// names are keys in upper case with _ for ., like REDIS_ADDR.
+func Load(args []string) (*Config, error) {
+	s, err := Open(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Config(), nil
+}
+
+// Open reads the config like Load, keeping the source to Watch
+func Open(args []string) (*Source, error) {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	flags := pflag.NewFlagSet("social-gin", pflag.ContinueOnError)
+	flags.String("config", "", "config file, yaml, json or toml")
+	flags.String("server.addr", "", "address to listen on")
+	flags.String("port", "", "address to listen on")
+	flags.MarkDeprecated("port", "use --server.addr instead")
+	flags.String("redis.addr", "", "redis host:port")
+	flags.String("log.level", "", "debug, info, warn or error")
+	flags.String("log.format", "", "json or console")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	// only flags given on the command line override
+	flags.Visit(func(f *pflag.Flag) {
+		v.BindPFlag(f.Name, f)
+	})
+
+	if file := v.GetString("config"); file != "" {
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("reading config %s: %w", file, err)
+		}
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("/etc/social-gin")
+		if err := v.ReadInConfig(); err != nil {
+			var notFound viper.ConfigFileNotFoundError
+			if !errors.As(err, &notFound) {
+				return nil, fmt.Errorf("reading config: %w", err)
+			}
+		}
+	}
+
+	s := &Source{v: v}
+	cfg, err := s.decode()
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(cfg)
+	return s, nil
+}
+
+// Config returns the config in effect, it mustn't be modified
+func (s *Source) Config() *Config {
+	return s.current.Load().(*Config)
+}
+
+// decode reads secrets and returns the validated config of v
+func (s *Source) decode() (*Config, error) {
+	if err := readSecrets(s.v); err != nil {
+		return nil, err
+	}
+	// port was renamed server.addr, port in the file, PORT and --port
+	// still set it unless server.addr is given too
+	if port := s.v.GetString("port"); port != "" {
+		if !strings.Contains(port, ":") {
+			port = ":" + port
+		}
+		s.v.SetDefault("server.addr", port)
+	}
+	cfg := &Config{File: s.v.ConfigFileUsed()}
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+	))
+	if err := s.v.Unmarshal(cfg, hook); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Reload rereads the config file and applies its reloadable settings,
+// returning the config before and after. An invalid file is rejected as a
+// whole and the config in effect stays. restart is true when the file also
+// changed settings that only apply on restart.
+func (s *Source) Reload() (old, cfg *Config, restart bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old = s.Config()
+	if s.v.ConfigFileUsed() == "" {
+		return old, old, false, nil
+	}
+	if err := s.v.ReadInConfig(); err != nil {
+		return old, old, false, fmt.Errorf("reading config %s: %w", s.v.ConfigFileUsed(), err)
+	}
+	fresh, err := s.decode()
+	if err != nil {
+		return old, old, false, err
+	}
+
+	next := *old
+	next.SetReloadable(fresh.Reloadable())
+	// what's left differing in fresh waits for a restart
+	fresh.SetReloadable(old.Reloadable())
+	restart = !reflect.DeepEqual(fresh, old)
+
+	s.current.Store(&next)
+	return old, &next, restart, nil
+}
+
+// Watch reloads whenever the config file changes and calls changed with
+// the result, it does nothing without a config file
+func (s *Source) Watch(changed func(old, cfg *Config, restart bool, err error)) {
+	if s.v.ConfigFileUsed() == "" {
+		return
+	}
+	s.v.OnConfigChange(func(fsnotify.Event) {
+		changed(s.Reload())
+	})
+	s.v.WatchConfig()
+}
+
+// Reloadable are the settings applied without a restart
+type Reloadable struct {
+	LogLevel      string        `json:"log.level"`
+	RateLimit     RateLimit     `json:"ratelimit"`
+	LoginTokenTTL time.Duration `json:"login.token_ttl"`
+	TokenTTL      time.Duration `json:"oauth.token_ttl"`
+}
+
+// Reloadable returns the settings of c applied without a restart
+func (c *Config) Reloadable() Reloadable {
+	return Reloadable{
+		LogLevel:      c.Log.Level,
+		RateLimit:     c.RateLimit,
+		LoginTokenTTL: c.Login.TokenTTL,
+		TokenTTL:      c.OAuth.TokenTTL,
+	}
+}
+
+// SetReloadable replaces the settings of c applied without a restart
+func (c *Config) SetReloadable(r Reloadable) {
+	c.Log.Level = r.LogLevel
+	c.RateLimit = r.RateLimit
+	c.Login.TokenTTL = r.LoginTokenTTL
+	c.OAuth.TokenTTL = r.TokenTTL
+}
+
+// readSecrets replaces each secret with the content of its file when one
+// is given
+func readSecrets(v *viper.Viper) error {
+	keys := append([]string{}, secrets...)
+	for name := range v.GetStringMap("oidc") {
+		keys = append(keys, "oidc."+name+".client_secret")
+	}
+	for _, key := range keys {
+		file := v.GetString(key + "_file")
+		if file == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("reading %s_file: %w", key, err)
+		}
+		// editors and echo leave a trailing newline
+		v.Set(key, strings.TrimRight(string(b), "\r\n"))
+	}
+	return nil
+}
+
+// messages explains each rule, %s is the key and %v the rule parameter
+var messages = map[string]string{
+	"required":      "%s is required",
+	"required_if":   "%s is required",
+	"required_with": "%s is required",
+	"oneof":         "%s must be one of %v",
+	"url":           "%s must be a url",
+	"hostname_port": "%s must be host:port",
+	"gt":            "%s must be greater than %v",
+	"gte":           "%s must be at least %v",
+	"lte":           "%s must be at most %v",
+	"gtfield":       "%s must be after %v",
+}
+
+var validate = validator.New()
+
+func init() {
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("mapstructure"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+// Validate checks every value, the error lists all invalid keys at once
+func (c *Config) Validate() error {
+	err := validate.Struct(c)
+	var errs validator.ValidationErrors
+	if err != nil && !errors.As(err, &errs) {
+		return err
+	}
+	problems := make([]string, 0, len(errs))
+	// browsers refuse credentials from any origin
+	if c.CORS.AllowCredentials && c.CORS.AllowsAny() {
+		problems = append(problems, "cors.allow_credentials can't be used with any origin")
+	}
+	// a lock ending before the request can let a retry run it twice
+	if c.Server.WriteTimeout > 0 && c.Idempotency.LockTTL < c.Server.WriteTimeout {
+		problems = append(problems, "idempotency.lock_ttl must be at least server.write_timeout")
+	}
+	// client certificates are only asked for over https
+	if c.Server.TLS.ClientCAFile != "" && !c.Server.TLS.Enabled() {
+		problems = append(problems, "server.tls.client_ca_file needs server.tls.cert_file and server.tls.key_file")
+	}
+	// browsers drop SameSite=None cookies that aren't Secure
+	if c.Session.SameSite == "none" && !c.Session.Secure {
+		problems = append(problems, "session.same_site none needs session.secure")
+	}
+	// browsers send the session cookie along with forged requests too
+	if c.Session.TTL > 0 && !c.CSRF.Enabled {
+		problems = append(problems, "session.ttl needs csrf.enabled")
+	}
+	// a different cookie would leave sessions unchecked
+	if c.CSRF.Enabled && c.Session.TTL > 0 && c.CSRF.SessionCookie != c.Session.Cookie() {
+		problems = append(problems, "csrf.session_cookie must be session.cookie_name")
+	}
+	// a sunset is only announced on deprecated routes
+	if !c.API.V1.Sunset.IsZero() && c.API.V1.Deprecation.IsZero() {
+		problems = append(problems, "api.v1.sunset needs api.v1.deprecation")
+	}
+	for _, e := range errs {
+		message, ok := messages[e.Tag()]
+		if !ok {
+			message = "%s is invalid"
+		}
+		if strings.Contains(message, "%v") {
+			// field parameters are go names of keys
+			problems = append(problems, fmt.Sprintf(message, key(e.Namespace()), strings.ToLower(e.Param())))
+		} else {
+			problems = append(problems, fmt.Sprintf(message, key(e.Namespace())))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+}
+
+// key turns a validator namespace like Config.log.Options.level into the
+// config key log.level. Keys are lower case, the upper case parts are the
+// root and squashed structs.
+func key(namespace string) string {
+	parts := strings.Split(namespace, ".")
+	kept := parts[:0]
+	for _, p := range parts {
+		if p != "" && !unicode.IsUpper(rune(p[0])) {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ".")
+}
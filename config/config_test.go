@@ -0,0 +1,239 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/config"
+)
+
+// setenv sets env for the test, returning the function restoring it
+func setenv(env map[string]string) func() {
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func write(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := write(t, dir, "config.yaml", `
+server:
+  addr: ":9000"
+redis:
+  addr: redis:6379
+log:
+  level: debug
+ratelimit:
+  limit: 5
+  login:
+    window: 30s
+api:
+  v1:
+    deprecation: 2026-10-19T00:00:00Z
+`)
+	password := write(t, dir, "redis_password", "s3cret\n")
+	defer setenv(map[string]string{
+		"DSN":                 "sqlserver://app@db:1433?database=social",
+		"LOG_LEVEL":           "warn",
+		"REDIS_PASSWORD_FILE": password,
+	})()
+
+	cfg, err := config.Load([]string{"--config", file, "--server.addr", ":9001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != file {
+		t.Error("want file", file, "but get", cfg.File)
+	}
+	if cfg.Server.Addr != ":9001" {
+		t.Error("given addr in file and flag want flag :9001 but get", cfg.Server.Addr)
+	}
+	if cfg.Log.Level != "warn" {
+		t.Error("given level in file and env want env warn but get", cfg.Log.Level)
+	}
+	if cfg.Redis.Addr != "redis:6379" {
+		t.Error("want redis addr from file but get", cfg.Redis.Addr)
+	}
+	if cfg.Redis.Password != "s3cret" {
+		t.Error("given password file want s3cret but get", cfg.Redis.Password)
+	}
+	if cfg.RateLimit.Limit.Limit != 5 || cfg.RateLimit.Login.Window != 30*time.Second || cfg.RateLimit.Login.Limit != 10 {
+		t.Error("want rate limits merged with defaults but get", cfg.RateLimit)
+	}
+	if !cfg.API.V1.Deprecation.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Error("want deprecation from file but get", cfg.API.V1.Deprecation)
+	}
+	if !cfg.API.V1.Sunset.IsZero() {
+		t.Error("want no sunset by default but get", cfg.API.V1.Sunset)
+	}
+}
+
+func TestLoadPort(t *testing.T) {
+	defer setenv(map[string]string{"DSN": "sqlserver://app@db:1433?database=social", "PORT": "9000"})()
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9000" {
+		t.Error("given PORT 9000 want addr :9000 but get", cfg.Server.Addr)
+	}
+
+	cfg, err = config.Load([]string{"--port", ":9001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9001" {
+		t.Error("given --port :9001 want addr :9001 but get", cfg.Server.Addr)
+	}
+
+	defer setenv(map[string]string{"SERVER_ADDR": ":9002"})()
+	cfg, err = config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9002" {
+		t.Error("given PORT and SERVER_ADDR want SERVER_ADDR :9002 but get", cfg.Server.Addr)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := write(t, dir, "config.yaml", `
+redis:
+  addr: redis
+health:
+  pool_ratio: 2
+tracing:
+  exporter: otlp
+  endpoint: ""
+log:
+  routes:
+    - route: /users/:uid
+      level: loud
+session:
+  ttl: 30m
+  same_site: loose
+csrf:
+  enabled: true
+  session_cookie: sid
+server:
+  tls:
+    client_ca_file: ca.pem
+api:
+  v1:
+    sunset: 2027-04-30T00:00:00Z
+`)
+	_, err = config.Load([]string{"--config", file})
+	if err == nil {
+		t.Fatal("given invalid config want error but get nil")
+	}
+	for _, want := range []string{
+		"dsn is required",
+		"redis.addr must be host:port",
+		"health.pool_ratio must be at most 1",
+		"tracing.endpoint is required",
+		"log.routes[0].level must be one of debug info warn error",
+		"session.same_site must be one of lax strict none",
+		"csrf.session_cookie must be session.cookie_name",
+		"server.tls.client_ca_file needs server.tls.cert_file and server.tls.key_file",
+		"api.v1.sunset needs api.v1.deprecation",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Error("want error containing", want, "but get", err)
+		}
+	}
+
+	if _, err := config.Load([]string{"--config", filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("given missing config file want error but get nil")
+	}
+}
+
+func TestLoadSessionNeedsCSRF(t *testing.T) {
+	defer setenv(map[string]string{"DSN": "sqlserver://app@db:1433?database=social"})()
+
+	cfg, err := config.Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Session.TTL != 0 {
+		t.Error("want sessions off by default but get ttl", cfg.Session.TTL)
+	}
+
+	defer setenv(map[string]string{"SESSION_TTL": "30m"})()
+	if _, err := config.Load(nil); err == nil || !strings.Contains(err.Error(), "session.ttl needs csrf.enabled") {
+		t.Error("given sessions without csrf want error but get", err)
+	}
+	defer setenv(map[string]string{"CSRF_ENABLED": "true"})()
+	if _, err := config.Load(nil); err != nil {
+		t.Error("given sessions with csrf want valid but get", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setenv(map[string]string{"DSN": "sqlserver://app@db:1433?database=social"})()
+
+	file := write(t, dir, "config.yaml", "log:\n  level: info\n")
+	s, err := config.Open([]string{"--config", file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write(t, dir, "config.yaml", "server:\n  addr: \":9000\"\nlog:\n  level: debug\nratelimit:\n  limit: 7\nlogin:\n  token_ttl: 1h\n")
+	old, cfg, restart, err := s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Log.Level != "info" || cfg.Log.Level != "debug" || cfg.RateLimit.Limit.Limit != 7 {
+		t.Error("want level info to debug and limit 7 but get", old.Log.Level, cfg.Log.Level, cfg.RateLimit.Limit.Limit)
+	}
+	if old.Login.TokenTTL != 10*time.Minute || cfg.Login.TokenTTL != time.Hour {
+		t.Error("want login token ttl 10m to 1h but get", old.Login.TokenTTL, cfg.Login.TokenTTL)
+	}
+	if cfg.Server.Addr != ":8080" || !restart {
+		t.Error("given addr changed want it kept until restart but get", cfg.Server.Addr, restart)
+	}
+	if s.Config() != cfg {
+		t.Error("want reloaded config in effect")
+	}
+
+	write(t, dir, "config.yaml", "log:\n  level: loud\n")
+	if _, _, _, err := s.Reload(); err == nil {
+		t.Error("given invalid level want error but get nil")
+	}
+	if s.Config().Log.Level != "debug" {
+		t.Error("given rejected file want level debug kept but get", s.Config().Log.Level)
+	}
+}
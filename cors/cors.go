@@ -0,0 +1,132 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+// Config represents which cross-origin requests browsers may make
+type Config struct {
+	// AllowOrigins are origins like https://app.example.com, a * stands
+	// for one subdomain level as in https://*.example.com, and * alone
+	// for any origin without credentials. CORS is off when empty.
+	AllowOrigins []string `mapstructure:"allow_origins"`
+	AllowMethods []string `mapstructure:"allow_methods"`
+	AllowHeaders []string `mapstructure:"allow_headers"`
+	// ExposeHeaders are the response headers scripts may read
+	ExposeHeaders []string `mapstructure:"expose_headers"`
+	// AllowCredentials lets browsers send cookies, it can't be used with
+	// any origin
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+	// MaxAge is how long browsers cache a preflight
+	MaxAge time.Duration `mapstructure:"max_age" validate:"gte=0"`
+}
+
+// Enabled tells whether any origin is allowed
+func (cfg Config) Enabled() bool {
+	return len(cfg.AllowOrigins) > 0
+}
+
+// AllowsAny tells whether every origin is allowed
+func (cfg Config) AllowsAny() bool {
+	for _, o := range cfg.AllowOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg Config) allowed(origin string) bool {
+	for _, o := range cfg.AllowOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+		// https://*.example.com matches one label in place of the *
+		if i := strings.Index(o, "*."); i >= 0 {
+			prefix, suffix := strings.ToLower(o[:i]), strings.ToLower(o[i+1:])
+			lower := strings.ToLower(origin)
+			if strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) {
+				label := lower[len(prefix) : len(lower)-len(suffix)]
+				if label != "" && !strings.Contains(label, ".") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Middleware return cors middleware function, it answers preflights itself
+// so they never reach routes
+func Middleware(cfg Config) gin.HandlerFunc {
+	methods := strings.Join(cfg.AllowMethods, ", ")
+	headers := strings.Join(cfg.AllowHeaders, ", ")
+	expose := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	allowsAny := cfg.AllowsAny() && !cfg.AllowCredentials
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			return
+		}
+		// the answer depends on the origin, caches must keep them apart
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !cfg.allowed(origin) {
+			if preflight {
+				apperror.Abort(c, apperror.Forbidden("origin not allowed"))
+			}
+			// the browser blocks the response without the headers
+			return
+		}
+
+		if allowsAny {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if expose != "" {
+				c.Header("Access-Control-Expose-Headers", expose)
+			}
+			return
+		}
+
+		method := c.GetHeader("Access-Control-Request-Method")
+		if !contains(cfg.AllowMethods, method) {
+			apperror.Abort(c, apperror.Forbidden("method not allowed cross-origin"))
+			return
+		}
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		c.Header("Access-Control-Allow-Methods", methods)
+		if headers != "" {
+			c.Header("Access-Control-Allow-Headers", headers)
+		}
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/cors"
+	"github.com/gin-gonic/gin"
+)
+
+func router(cfg cors.Config) *gin.Engine {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.Use(cors.Middleware(cfg))
+	r.GET("/users", func(c *gin.Context) {
+		c.Header("ETag", `"1"`)
+		c.String(http.StatusOK, "users")
+	})
+	return r
+}
+
+var config = cors.Config{
+	AllowOrigins:     []string{"https://app.example.com", "https://*.preview.example.com"},
+	AllowMethods:     []string{"GET", "POST"},
+	AllowHeaders:     []string{"Authorization", "Content-Type"},
+	ExposeHeaders:    []string{"ETag"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+func TestPreflight(t *testing.T) {
+	r := router(config)
+
+	req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+	req.Header.Set("Origin", "https://pr-1.preview.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Error("given allowed preflight want status", http.StatusNoContent, "but get", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://pr-1.preview.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Error("want", header, want, "but get", got)
+		}
+	}
+
+	for _, origin := range []string{"https://evil.com", "https://a.b.preview.example.com"} {
+		req = httptest.NewRequest(http.MethodOptions, "/users", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		rec = httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Error("given origin", origin, "want forbidden without allow origin but get", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
+
+func TestSimpleRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	router(config).ServeHTTP(rec, req)
+
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Error("want origin allowed but get", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Error("want ETag exposed but get", rec.Header().Get("Access-Control-Expose-Headers"))
+	}
+	if rec.Header().Get("Vary") != "Origin" {
+		t.Error("want Vary Origin but get", rec.Header().Get("Vary"))
+	}
+
+	wildcard := cors.Config{AllowOrigins: []string{"*"}, AllowMethods: []string{"GET"}}
+	rec = httptest.NewRecorder()
+	router(wildcard).ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("given any origin want * but get", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,105 @@
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+// Config represents double-submit csrf protection. Scripts of the site
+// read the token cookie and echo it in the header, which other sites can't
+// since they can't read the cookie.
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// CookieName holds the token, csrf_token when empty. A __Host- prefixed
+	// name keeps subdomains from setting it.
+	CookieName string `mapstructure:"cookie_name"`
+	// HeaderName carries the token back, X-CSRF-Token when empty
+	HeaderName string `mapstructure:"header_name"`
+	// SessionCookie authenticates requests, only requests sending it are
+	// checked since without it there's nothing to forge
+	SessionCookie string `mapstructure:"session_cookie" validate:"required_if=Enabled true"`
+	// Secure sends the token cookie over https only
+	Secure bool `mapstructure:"secure"`
+}
+
+func (cfg Config) cookieName() string {
+	if cfg.CookieName == "" {
+		return "csrf_token"
+	}
+	return cfg.CookieName
+}
+
+func (cfg Config) headerName() string {
+	if cfg.HeaderName == "" {
+		return "X-CSRF-Token"
+	}
+	return cfg.HeaderName
+}
+
+// safe methods don't change anything so they aren't checked
+var safe = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Middleware return csrf middleware function. It hands out a token cookie
+// when the request has none and rejects unsafe requests sending the session
+// cookie without the token in the header.
+func Middleware(cfg Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(cfg.cookieName())
+		if err != nil || token == "" {
+			if token, err = New(); err != nil {
+				apperror.Abort(c, apperror.Internal(err))
+				return
+			}
+			SetCookie(c, cfg, token)
+		}
+		c.Set("csrf_token", token)
+
+		if safe[c.Request.Method] {
+			return
+		}
+		if _, err := c.Cookie(cfg.SessionCookie); err != nil {
+			return
+		}
+		sent := c.GetHeader(cfg.headerName())
+		if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			apperror.Abort(c, apperror.Forbidden("csrf token missing or invalid"))
+		}
+	}
+}
+
+// New creates a random token
+func New() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SetCookie sets the token cookie, readable by scripts so they can echo it.
+// Rotating the token on login keeps a token planted before from working.
+func SetCookie(c *gin.Context, cfg Config, token string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     cfg.cookieName(),
+		Value:    token,
+		Path:     "/",
+		Secure:   cfg.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Set("csrf_token", token)
+}
+
+// Token returns the token of the request, for pages embedding it
+func Token(c *gin.Context) string {
+	return c.GetString("csrf_token")
+}
@@ -0,0 +1,63 @@
+package csrf_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/csrf"
+	"github.com/gin-gonic/gin"
+)
+
+func router() *gin.Engine {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.Use(csrf.Middleware(csrf.Config{Enabled: true, SessionCookie: "session"}))
+	r.GET("/users", func(c *gin.Context) {
+		c.String(http.StatusOK, csrf.Token(c))
+	})
+	r.POST("/users", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	return r
+}
+
+func post(r *gin.Engine, cookies []*http.Cookie, header string) int {
+	req := httptest.NewRequest(http.MethodPost, "/users", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	if header != "" {
+		req.Header.Set("X-CSRF-Token", header)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestMiddleware(t *testing.T) {
+	r := router()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || cookies[0].Value != rec.Body.String() {
+		t.Fatal("given no token cookie want one set but get", cookies)
+	}
+	token := cookies[0].Value
+	session := &http.Cookie{Name: "session", Value: "s"}
+
+	if code := post(r, []*http.Cookie{cookies[0], session}, token); code != http.StatusCreated {
+		t.Error("given matching header want status", http.StatusCreated, "but get", code)
+	}
+	if code := post(r, []*http.Cookie{cookies[0], session}, ""); code != http.StatusForbidden {
+		t.Error("given session without header want status", http.StatusForbidden, "but get", code)
+	}
+	if code := post(r, []*http.Cookie{cookies[0], session}, "forged"); code != http.StatusForbidden {
+		t.Error("given wrong header want status", http.StatusForbidden, "but get", code)
+	}
+	if code := post(r, nil, ""); code != http.StatusCreated {
+		t.Error("given no session cookie want status", http.StatusCreated, "but get", code)
+	}
+}
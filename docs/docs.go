@@ -0,0 +1,205 @@
+package docs
+
+import (
+	"net/http"
+	"time"
+
+	"example.com/social-gin/admin"
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/health"
+	"example.com/social-gin/oauth"
+	"example.com/social-gin/openapi"
+	"example.com/social-gin/patch"
+	"example.com/social-gin/post"
+	"example.com/social-gin/user"
+)
+
+// form content type of the login style endpoints
+const form = "application/x-www-form-urlencoded"
+
+// Credentials represents the form of login and restore requests
+type Credentials struct {
+	U string `json:"u" binding:"required"`
+	P string `json:"p" binding:"required"`
+}
+
+// LogInForm represents the form of login request, session asks for a
+// session cookie instead of the token
+type LogInForm struct {
+	U       string `json:"u" binding:"required"`
+	P       string `json:"p" binding:"required"`
+	Session bool   `json:"session"`
+}
+
+// Token represents response of login requests
+type Token struct {
+	Token string `json:"token"`
+}
+
+// TokenRequest represents the form of oauth token request
+type TokenRequest struct {
+	GrantType    string `json:"grant_type" binding:"required"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	Scope        string `json:"scope"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// OAuthToken represents response of oauth token request
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// ClientRegistration represents response of register client request, the
+// secret is only ever shown here
+type ClientRegistration struct {
+	Client       oauth.Client `json:"client"`
+	ClientSecret string       `json:"client_secret"`
+}
+
+// ScopeInfo describes a scope on the consent screen
+type ScopeInfo struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// AuthorizeInfo represents what the consent screen shows
+type AuthorizeInfo struct {
+	ClientID string      `json:"client_id"`
+	Name     string      `json:"name"`
+	Scopes   []ScopeInfo `json:"scopes"`
+}
+
+// ConsentForm represents the form of consent request
+type ConsentForm struct {
+	ClientID            string `json:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" binding:"required"`
+	ResponseType        string `json:"response_type" binding:"required"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge" binding:"required"`
+	CodeChallengeMethod string `json:"code_challenge_method" binding:"required"`
+	Approve             bool   `json:"approve"`
+}
+
+// Revoked represents response of revoke consent request
+type Revoked struct {
+	ClientID string `json:"client_id"`
+}
+
+// ExportStatus represents response of export requests
+type ExportStatus struct {
+	ID          uint       `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StatusURL   string     `json:"status_url"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Message represents response of hello request
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Info describes the API
+var Info = openapi.Info{
+	Title:   "social-gin",
+	Version: "1.0.0",
+}
+
+// Routes documents every route registered by router.Register
+var Routes = routes()
+
+// resources are the routes served under every api version
+var resources = []openapi.Route{
+	{Method: http.MethodGet, Path: "/users", Tag: "users", Summary: "List users", Response: []user.User{}},
+	{Method: http.MethodGet, Path: "/users/:uid", Tag: "users", Summary: "Get user", Response: user.User{}},
+	{Method: http.MethodPost, Path: "/users", Tag: "users", Summary: "Sign up", Request: user.UserRequest{}, Response: user.User{}},
+	{Method: http.MethodPut, Path: "/users/:uid", Tag: "users", Summary: "Replace user", Auth: true, Scope: "users:write", Request: user.UserRequest{}, Response: user.User{}},
+	{Method: http.MethodPatch, Path: "/users/:uid", Tag: "users", Summary: "Patch user with merge patch or json patch", Auth: true, Scope: "users:write", Request: user.UserRequest{}, RequestType: patch.MergePatchType, Response: user.User{}},
+	{Method: http.MethodDelete, Path: "/users/:uid", Tag: "users", Summary: "Delete user", Auth: true, Scope: "users:write", Query: []string{"permanent"}, Response: user.User{}},
+	{Method: http.MethodPost, Path: "/users/:uid/restore", Tag: "users", Summary: "Restore deleted user", Request: Credentials{}, RequestType: form, Response: user.User{}},
+	{Method: http.MethodGet, Path: "/users/:uid/posts", Tag: "posts", Summary: "List posts of user", Response: []post.Post{}},
+	{Method: http.MethodGet, Path: "/users/:uid/posts/:pid", Tag: "posts", Summary: "Get post", Response: post.Post{}},
+	{Method: http.MethodPost, Path: "/users/:uid/posts", Tag: "posts", Summary: "Add post", Auth: true, Scope: "posts:write", Request: post.PostRequest{}, Response: post.Post{}},
+	{Method: http.MethodPut, Path: "/users/:uid/posts/:pid", Tag: "posts", Summary: "Replace post", Auth: true, Scope: "posts:write", Request: post.PostRequest{}, Response: post.Post{}},
+	{Method: http.MethodPatch, Path: "/users/:uid/posts/:pid", Tag: "posts", Summary: "Patch post with merge patch or json patch", Auth: true, Scope: "posts:write", Request: post.PostRequest{}, RequestType: patch.MergePatchType, Response: post.Post{}},
+	{Method: http.MethodDelete, Path: "/users/:uid/posts/:pid", Tag: "posts", Summary: "Delete post", Auth: true, Scope: "posts:write", Query: []string{"permanent"}, Response: post.Post{}},
+	{Method: http.MethodGet, Path: "/users/:uid/deleted-posts", Tag: "posts", Summary: "List restorable posts", Auth: true, Scope: "posts:write", Response: []post.Post{}},
+	{Method: http.MethodPost, Path: "/users/:uid/posts/:pid/restore", Tag: "posts", Summary: "Restore deleted post", Auth: true, Scope: "posts:write", Response: post.Post{}},
+	{Method: http.MethodPost, Path: "/users/:uid/export", Tag: "export", Summary: "Request data export", Auth: true, Status: http.StatusAccepted, Response: ExportStatus{}},
+	{Method: http.MethodGet, Path: "/users/:uid/exports/:eid", Tag: "export", Summary: "Get export status", Auth: true, Response: ExportStatus{}},
+}
+
+func routes() []openapi.Route {
+	all := []openapi.Route{
+		{Method: http.MethodGet, Path: "/hello", Tag: "misc", Summary: "Say hello", Response: Message{}},
+		{Method: http.MethodGet, Path: "/healthz", Tag: "health", Summary: "Liveness probe", Response: health.Report{}},
+		{Method: http.MethodGet, Path: "/metrics", Tag: "health", Summary: "Prometheus metrics", ContentType: "text/plain", Response: &openapi.Schema{Type: "string"}},
+		{Method: http.MethodGet, Path: "/readyz", Tag: "health", Summary: "Readiness probe with dependency breakdown, 503 when not ready", Response: health.Report{}},
+		{Method: http.MethodGet, Path: "/openapi.json", Tag: "misc", Summary: "This document", Response: &openapi.Schema{Type: "object"}},
+		{Method: http.MethodGet, Path: "/docs", Tag: "misc", Summary: "Interactive API docs", ContentType: "text/html", Response: &openapi.Schema{Type: "string"}},
+		{Method: http.MethodGet, Path: "/docs/assets/*file", Tag: "misc", Summary: "Swagger UI files of the docs page", ContentType: "text/javascript", Response: &openapi.Schema{Type: "string"}},
+		{Method: http.MethodPost, Path: "/login", Tag: "auth", Summary: "Log in with username and password, a session login sets the cookie and returns 204", Request: LogInForm{}, RequestType: form, Response: Token{}},
+		{Method: http.MethodPost, Path: "/logout", Tag: "auth", Summary: "End session and clear its cookie or revoke bearer token", Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/auth/:provider/login", Tag: "auth", Summary: "Redirect to identity provider sign in", Status: http.StatusFound},
+		{Method: http.MethodGet, Path: "/auth/:provider/callback", Tag: "auth", Summary: "Complete identity provider sign in", Query: []string{"code", "state", "error"}, Response: Token{}},
+		{Method: http.MethodPost, Path: "/oauth/token", Tag: "oauth", Summary: "Exchange grant for access token", Request: TokenRequest{}, RequestType: form, Response: OAuthToken{}},
+		{Method: http.MethodPost, Path: "/oauth/clients", Tag: "oauth", Summary: "Register client", Auth: true, Request: oauth.ClientRequest{}, Response: ClientRegistration{}},
+		{Method: http.MethodGet, Path: "/oauth/authorize", Tag: "oauth", Summary: "Describe authorization request", Auth: true, Query: []string{"client_id", "redirect_uri", "response_type", "scope", "state", "code_challenge", "code_challenge_method"}, Response: AuthorizeInfo{}},
+		{Method: http.MethodPost, Path: "/oauth/authorize", Tag: "oauth", Summary: "Grant or deny consent", Auth: true, Request: ConsentForm{}, RequestType: form, Status: http.StatusFound},
+		{Method: http.MethodGet, Path: "/oauth/consents", Tag: "oauth", Summary: "List consents", Auth: true, Response: []oauth.Consent{}},
+		{Method: http.MethodDelete, Path: "/oauth/consents/:cid", Tag: "oauth", Summary: "Revoke consent", Auth: true, Response: Revoked{}},
+		{Method: http.MethodGet, Path: "/exports/:eid/download", Tag: "export", Summary: "Download export archive", Query: []string{"token"}, ContentType: "application/zip", Response: &openapi.Schema{Type: "string", Format: "binary"}},
+		{Method: http.MethodGet, Path: "/tables", Tag: "misc", Summary: "List database tables", Auth: true, Response: []string{}},
+		{Method: http.MethodGet, Path: "/admin/log/level", Tag: "admin", Summary: "Get log level", Auth: true, Response: admin.LogLevel{}},
+		{Method: http.MethodPut, Path: "/admin/log/level", Tag: "admin", Summary: "Change log level until restart", Auth: true, Request: admin.LogLevel{}, Response: admin.LogLevel{}},
+		{Method: http.MethodGet, Path: "/admin/audit", Tag: "admin", Summary: "List audit entries, newest first", Auth: true, Query: []string{"actor", "action", "target", "since", "until", "before", "limit"}, Response: []audit.Entry{}},
+		{Method: http.MethodGet, Path: "/admin/audit/verify", Tag: "admin", Summary: "Verify audit hash chain", Auth: true, Response: audit.Verification{}},
+	}
+	all = append(all, versioned("", 1, true)...)
+	all = append(all, versioned("/v1", 1, true)...)
+	return append(all, versioned("/v2", 2, false)...)
+}
+
+// versioned documents resources under prefix as api version n
+func versioned(prefix string, n int, deprecated bool) []openapi.Route {
+	routes := make([]openapi.Route, 0, len(resources))
+	for _, route := range resources {
+		route.Path = prefix + route.Path
+		route.Deprecated = deprecated
+		if n >= 2 {
+			route.Response = v2(route.Response)
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// v2 swaps responses for their api v2 representation
+func v2(response interface{}) interface{} {
+	switch response.(type) {
+	case user.User:
+		return user.UserV2{}
+	case []user.User:
+		return []user.UserV2{}
+	case post.Post:
+		return post.PostV2{}
+	case []post.Post:
+		return []post.PostV2{}
+	}
+	return response
+}
+
+// Document builds the OpenAPI document of Routes
+func Document() *openapi.Document {
+	return openapi.Build(Info, Routes, apperror.Problem{})
+}
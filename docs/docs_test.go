@@ -0,0 +1,96 @@
+package docs_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"example.com/social-gin/admin"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/docs"
+	"example.com/social-gin/export"
+	"example.com/social-gin/health"
+	"example.com/social-gin/oauth"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/openapi"
+	"example.com/social-gin/post"
+	"example.com/social-gin/router"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+)
+
+// routes registers the routes of the api, handlers are never called
+func routes() gin.RoutesInfo {
+	noop := func(c *gin.Context) {}
+	rt := &router.Router{
+		User:       &user.Handler{},
+		Post:       &post.Handler{},
+		OIDC:       &oidc.Handler{},
+		OAuth:      &oauth.Handler{},
+		Export:     &export.Handler{},
+		Health:     &health.Handler{},
+		Admin:      &admin.Handler{},
+		Audit:      &audit.Trail{},
+		Metrics:    noop,
+		Internal:   noop,
+		Limit:      noop,
+		UserLimit:  noop,
+		LoginLimit: noop,
+		Idempotent: noop,
+	}
+	r := gin.New()
+	rt.Register(r)
+	return r.Routes()
+}
+
+func TestEveryRouteDocumented(t *testing.T) {
+	registered := routes()
+	if len(registered) == 0 {
+		t.Fatal("want routes registered but get none")
+	}
+
+	for _, missing := range openapi.Missing(registered, docs.Routes) {
+		t.Error("route", missing, "is registered but missing from docs.Routes")
+	}
+
+	// and nothing is documented that isn't served
+	served := make([]openapi.Route, 0, len(registered))
+	for _, r := range registered {
+		served = append(served, openapi.Route{Method: r.Method, Path: r.Path})
+	}
+	documented := gin.RoutesInfo{}
+	for _, r := range docs.Routes {
+		documented = append(documented, gin.RouteInfo{Method: r.Method, Path: r.Path})
+	}
+	for _, stale := range openapi.Missing(documented, served) {
+		t.Error("route", stale, "is in docs.Routes but not registered")
+	}
+}
+
+func TestDocument(t *testing.T) {
+	doc := docs.Document()
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Error("can't marshal document", err)
+	}
+
+	op := doc.Paths["/users/{uid}"]["patch"]
+	if op == nil {
+		t.Error("want PATCH /users/{uid} in document but get none")
+		return
+	}
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "uid" {
+		t.Error("want path parameter uid but get", op.Parameters)
+	}
+
+	schema := doc.Components.Schemas["UserRequest"]
+	if schema == nil {
+		t.Error("want UserRequest schema but get none")
+		return
+	}
+	if len(schema.Required) != 3 {
+		t.Error("want 3 required UserRequest fields but get", schema.Required)
+	}
+	if p := schema.Properties["username"]; p == nil || p.MaxLength == nil || *p.MaxLength != 32 {
+		t.Error("want username maxLength 32 but get", p)
+	}
+}
@@ -0,0 +1,73 @@
+package etag
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+// Of returns the entity tag of a resource version
+func Of(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// Set sets the ETag header of the response
+func Set(c *gin.Context, version uint) {
+	c.Header("ETag", Of(version))
+}
+
+// NotModified sets the ETag header and answers 304 when the client already
+// has this version, the caller must not write a body when it returns true
+func NotModified(c *gin.Context, version uint) bool {
+	Set(c, version)
+	if !match(c.GetHeader("If-None-Match"), Of(version), true) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// Check validates the If-Match header against the current version, a
+// missing header is accepted unless required
+func Check(c *gin.Context, version uint, required bool) error {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if required {
+			return apperror.New(apperror.CodePreconditionRequired, "If-Match header is required")
+		}
+		return nil
+	}
+	if !match(header, Of(version), false) {
+		return Modified()
+	}
+	return nil
+}
+
+// Modified is the error of a write based on a stale version
+func Modified() error {
+	return apperror.New(apperror.CodePreconditionFailed, "resource has been modified, fetch it again and retry")
+}
+
+// match reports whether tag is in the header list, weak comparison ignores
+// the W/ prefix as If-None-Match requires
+func match(header, tag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if strings.HasPrefix(t, "W/") {
+			if !weak {
+				continue
+			}
+			t = t[2:]
+		}
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package etag_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/etag"
+	"github.com/gin-gonic/gin"
+)
+
+const version = 3
+
+func setupRouter(required bool) *gin.Engine {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.GET("/post", func(c *gin.Context) {
+		if etag.NotModified(c, version) {
+			return
+		}
+		c.String(http.StatusOK, "post")
+	})
+	r.PUT("/post", func(c *gin.Context) {
+		if err := etag.Check(c, version, required); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		c.String(http.StatusOK, "updated")
+	})
+	return r
+}
+
+func serve(r *gin.Engine, method, header, value string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/post", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNotModified(t *testing.T) {
+	r := setupRouter(false)
+
+	rec := serve(r, http.MethodGet, "", "")
+	if rec.Code != http.StatusOK {
+		t.Error("status code is not ok", rec.Code)
+		return
+	}
+	tag := rec.Header().Get("ETag")
+	if tag != etag.Of(version) {
+		t.Error("want ETag", etag.Of(version), "but get", tag)
+	}
+
+	tests := []struct {
+		given string
+		want  int
+	}{
+		{tag, http.StatusNotModified},
+		{"W/" + tag, http.StatusNotModified},
+		{`"1", ` + tag, http.StatusNotModified},
+		{`"1"`, http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := serve(r, http.MethodGet, "If-None-Match", test.given)
+		if rec.Code != test.want {
+			t.Error("given If-None-Match", test.given, "want status", test.want, "but get", rec.Code)
+		}
+		if test.want == http.StatusNotModified && rec.Body.Len() > 0 {
+			t.Error("given If-None-Match", test.given, "want empty body but get", rec.Body.String())
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		required bool
+		given    string
+		want     int
+	}{
+		{false, "", http.StatusOK},
+		{true, "", http.StatusPreconditionRequired},
+		{true, etag.Of(version), http.StatusOK},
+		{true, "*", http.StatusOK},
+		{true, etag.Of(version - 1), http.StatusPreconditionFailed},
+		{true, "W/" + etag.Of(version), http.StatusPreconditionFailed},
+	}
+	for _, test := range tests {
+		header := ""
+		if test.given != "" {
+			header = "If-Match"
+		}
+		rec := serve(setupRouter(test.required), http.MethodPut, header, test.given)
+		if rec.Code != test.want {
+			t.Error("given required", test.required, "If-Match", test.given, "want status", test.want, "but get", rec.Code)
+		}
+	}
+}
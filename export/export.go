@@ -0,0 +1,208 @@
+package export
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// export status
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusExpired = "expired"
+)
+
+// Export represents a data export job of a user
+type Export struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"update_at"`
+	UserID        int        `gorm:"index" json:"user_id"`
+	Status        string     `gorm:"size:16;index" json:"status"`
+	Error         string     `json:"error,omitempty"`
+	File          string     `json:"-"`
+	DownloadToken string     `gorm:"size:64" json:"-"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// Source collects data about a user for the export
+type Source func(db *gorm.DB, uid uint) (interface{}, error)
+
+// Rows exports every row of a model owned by the user, list is an empty
+// slice of the model and column the one holding the user id
+func Rows(list interface{}, column string) Source {
+	t := reflect.TypeOf(list)
+	return func(db *gorm.DB, uid uint) (interface{}, error) {
+		rows := reflect.New(t)
+		if err := db.Where(column+" = ?", uid).Find(rows.Interface()).Error; err != nil {
+			return nil, err
+		}
+		return rows.Elem().Interface(), nil
+	}
+}
+
+// Handler handles data export requests
+type Handler struct {
+	DB *gorm.DB
+	// Dir is where archives are written, it must be shared between instances
+	Dir string
+	// TTL is how long an archive can be downloaded
+	TTL time.Duration
+	// Sources maps a file name in the archive to the data it holds
+	Sources map[string]Source
+
+	wake chan struct{}
+}
+
+// RequestExport handle request export of the login user data
+func (h *Handler) RequestExport(c *gin.Context) {
+	uid, err := strconv.Atoi(c.Param("uid"))
+
+	loginUid := c.MustGet("uid")
+
+	if loginUid != c.Param("uid") {
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
+		return
+	}
+
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
+		return
+	}
+
+	export := Export{
+		UserID: uid,
+		Status: StatusPending,
+	}
+	if result := h.DB.Create(&export); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	h.notify()
+
+	c.Header("Location", statusPath(export))
+	c.JSON(http.StatusAccepted, h.view(export))
+}
+
+// GetExport handle get export status request
+func (h *Handler) GetExport(c *gin.Context) {
+	export, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	loginUid := c.MustGet("uid")
+
+	if loginUid != strconv.Itoa(export.UserID) || c.Param("uid") != loginUid {
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.view(export))
+}
+
+// Download handle download export request, the link itself authorizes the
+// download so it works from a plain browser navigation
+func (h *Handler) Download(c *gin.Context) {
+	export, ok := h.find(c)
+	if !ok {
+		return
+	}
+
+	token := c.Query("token")
+	if export.DownloadToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(export.DownloadToken)) != 1 {
+		apperror.Abort(c, apperror.NotFound("record not found"))
+		return
+	}
+	if export.Status != StatusDone || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		apperror.Abort(c, apperror.Gone("export link has expired"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.File, fmt.Sprintf("export-%d.zip", export.UserID))
+}
+
+func (h *Handler) find(c *gin.Context) (Export, bool) {
+	export := Export{}
+	eid, err := strconv.Atoi(c.Param("eid"))
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest("invalid export id"))
+		return export, false
+	}
+	if result := h.DB.First(&export, eid); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return export, false
+	}
+	return export, true
+}
+
+// view adds the download link once the archive is ready
+func (h *Handler) view(export Export) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":         export.ID,
+		"status":     export.Status,
+		"created_at": export.CreatedAt,
+		"status_url": statusPath(export),
+	}
+	if export.Error != "" {
+		v["error"] = export.Error
+	}
+	if export.Status == StatusDone {
+		v["download_url"] = fmt.Sprintf("/exports/%d/download?token=%s", export.ID, export.DownloadToken)
+		v["expires_at"] = export.ExpiresAt
+	}
+	return v
+}
+
+func statusPath(export Export) string {
+	return fmt.Sprintf("/users/%d/exports/%d", export.UserID, export.ID)
+}
+
+// Cleanup removes archives past their expiry and requeues jobs left
+// running by an instance that died
+func (h *Handler) Cleanup() error {
+	stuck := h.DB.Model(&Export{}).Where("status = ? and updated_at < ?", StatusRunning, time.Now().Add(-time.Hour))
+	if err := stuck.Update("status", StatusPending).Error; err != nil {
+		return err
+	}
+
+	exports := []Export{}
+	if err := h.DB.Where("status = ? and expires_at < ?", StatusDone, time.Now()).Find(&exports).Error; err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err := os.Remove(export.File); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := h.DB.Model(&export).Updates(map[string]interface{}{
+			"status":         StatusExpired,
+			"file":           "",
+			"download_token": "",
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
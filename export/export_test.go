@@ -0,0 +1,159 @@
+package export_test
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/export"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setup(t *testing.T) (*export.Handler, *gin.Engine) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&user.User{}, &export.Export{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&user.User{Username: "blink", Password: "password", Email: "blink@example.com"})
+
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	h := &export.Handler{
+		DB:      db,
+		Dir:     dir,
+		TTL:     time.Hour,
+		Sources: map[string]export.Source{"profile.json": user.Profile},
+	}
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	g := r.Group("", func(c *gin.Context) { c.Set("uid", "1") })
+	g.POST("/users/:uid/export", h.RequestExport)
+	g.GET("/users/:uid/exports/:eid", h.GetExport)
+	r.GET("/exports/:eid/download", h.Download)
+	return h, r
+}
+
+func do(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+// wait polls the export status until it's done
+func wait(t *testing.T, r *gin.Engine, path string) map[string]interface{} {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status := map[string]interface{}{}
+		json.Unmarshal(do(r, http.MethodGet, path).Body.Bytes(), &status)
+		if status["status"] == export.StatusDone {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want export done but get", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExport(t *testing.T) {
+	h, r := setup(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := h.Start(ctx, zap.NewNop())
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if rec := do(r, http.MethodPost, "/users/2/export"); rec.Code != http.StatusForbidden {
+		t.Error("given export of another user want 403 but get", rec.Code)
+	}
+	rec := do(r, http.MethodPost, "/users/1/export")
+	if rec.Code != http.StatusAccepted {
+		t.Fatal("want 202 but get", rec.Code, rec.Body.String())
+	}
+	status := wait(t, r, rec.Header().Get("Location"))
+	link := status["download_url"].(string)
+
+	rec = do(r, http.MethodGet, link)
+	if rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	archive, err := zip.NewReader(strings.NewReader(rec.Body.String()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "profile.json" {
+		t.Fatal("want profile.json in archive but get", archive.File)
+	}
+	f, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, _ := ioutil.ReadAll(f)
+	if !strings.Contains(string(profile), `"username": "blink"`) || strings.Contains(string(profile), "password") {
+		t.Error("want profile without password but get", string(profile))
+	}
+
+	for _, wrong := range []string{"", "0000"} {
+		path := link[:strings.Index(link, "?")] + "?token=" + wrong
+		if rec := do(r, http.MethodGet, path); rec.Code != http.StatusNotFound {
+			t.Error("given download token", wrong, "want 404 but get", rec.Code)
+		}
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	h, r := setup(t)
+	file := filepath.Join(h.Dir, "1-old.zip")
+	if err := ioutil.WriteFile(file, []byte("zip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-time.Minute)
+	h.DB.Create(&export.Export{UserID: 1, Status: export.StatusDone, File: file, DownloadToken: "abc", ExpiresAt: &expired})
+	h.DB.Create(&export.Export{UserID: 1, Status: export.StatusRunning})
+	h.DB.Model(&export.Export{}).Where("id = 2").UpdateColumn("updated_at", time.Now().Add(-2*time.Hour))
+
+	if rec := do(r, http.MethodGet, "/exports/1/download?token=abc"); rec.Code != http.StatusGone {
+		t.Error("given expired link want 410 but get", rec.Code)
+	}
+
+	if err := h.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("given expired export want archive removed but get", err)
+	}
+	exports := []export.Export{}
+	h.DB.Order("id").Find(&exports)
+	if exports[0].Status != export.StatusExpired || exports[0].DownloadToken != "" {
+		t.Error("want expired export without token but get", exports[0])
+	}
+	if exports[1].Status != export.StatusPending {
+		t.Error("given export stuck running want it requeued but get", exports[1].Status)
+	}
+	if rec := do(r, http.MethodGet, "/exports/1/download?token=abc"); rec.Code != http.StatusNotFound {
+		t.Error("given cleaned up export want 404 but get", rec.Code)
+	}
+}
@@ -0,0 +1,153 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pollInterval is how often the worker looks for jobs queued by other instances
+const pollInterval = time.Minute
+
+// Start runs the export worker until ctx is done, the returned channel is
+// closed once the job in progress has finished
+func (h *Handler) Start(ctx context.Context, logger *zap.Logger) <-chan struct{} {
+	h.wake = make(chan struct{}, 1)
+	done := make(chan struct{})
+	l := logger.With(zap.String("worker", "export"))
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			h.drain(ctx, l)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return done
+}
+
+func (h *Handler) notify() {
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drain processes pending exports one by one
+func (h *Handler) drain(ctx context.Context, l *zap.Logger) {
+	for ctx.Err() == nil {
+		exports := []Export{}
+		if err := h.DB.Where("status = ?", StatusPending).Order("id").Limit(10).Find(&exports).Error; err != nil {
+			l.Error("can't list pending exports", zap.Error(err))
+			return
+		}
+		if len(exports) == 0 {
+			return
+		}
+
+		for _, export := range exports {
+			// claim the job so other instances skip it
+			result := h.DB.Model(&Export{}).Where("id = ? and status = ?", export.ID, StatusPending).Update("status", StatusRunning)
+			if result.Error != nil {
+				l.Error("can't claim export", zap.Uint("id", export.ID), zap.Error(result.Error))
+				return
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			if err := h.run(export); err != nil {
+				l.Error("export failed", zap.Uint("id", export.ID), zap.Error(err))
+				h.DB.Model(&export).Updates(map[string]interface{}{
+					"status": StatusFailed,
+					"error":  "export failed, please request a new one",
+				})
+				continue
+			}
+			l.Info("export done", zap.Uint("id", export.ID), zap.Int("uid", export.UserID))
+		}
+	}
+}
+
+// run writes the archive and publishes its download link
+func (h *Handler) run(export Export) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(h.Dir, 0700); err != nil {
+		return err
+	}
+	file := filepath.Join(h.Dir, fmt.Sprintf("%d-%s.zip", export.ID, token[:16]))
+	if err := h.write(file, uint(export.UserID)); err != nil {
+		os.Remove(file)
+		return err
+	}
+
+	expiresAt := time.Now().Add(h.TTL)
+	return h.DB.Model(&export).Updates(map[string]interface{}{
+		"status":         StatusDone,
+		"file":           file,
+		"download_token": token,
+		"expires_at":     expiresAt,
+	}).Error
+}
+
+func (h *Handler) write(file string, uid uint) error {
+	tmp, err := ioutil.TempFile(h.Dir, "export-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	names := make([]string, 0, len(h.Sources))
+	for name := range h.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := zip.NewWriter(tmp)
+	for _, name := range names {
+		data, err := h.Sources[name](h.DB, uid)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		f, err := w.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	"gorm.io/gorm"
+)
+
+// SQL checks the database answers a ping
+func SQL(db *sql.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// Redis checks redis answers a ping
+func Redis(client *redis.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return client.WithContext(ctx).Ping().Err()
+	}
+}
+
+// Pool checks at most ratio of the open connection limit is in use, a
+// saturated pool makes requests queue for a connection
+func Pool(db *sql.DB, ratio float64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stats := db.Stats()
+		if stats.MaxOpenConnections == 0 {
+			return nil
+		}
+		if used := float64(stats.InUse) / float64(stats.MaxOpenConnections); used > ratio {
+			return fmt.Errorf("%d of %d connections in use, %d waits so far", stats.InUse, stats.MaxOpenConnections, stats.WaitCount)
+		}
+		return nil
+	}
+}
+
+// Migrated checks the tables of every model exist
+func Migrated(db *gorm.DB, models ...interface{}) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		migrator := db.WithContext(ctx).Migrator()
+		for _, model := range models {
+			if !migrator.HasTable(model) {
+				return fmt.Errorf("table of %T is missing", model)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// check statuses
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check is one dependency readiness depends on
+type Check struct {
+	Name string
+	// Timeout bounds the check, one second when zero
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Result represents outcome of a check. Why a check failed is only logged,
+// readiness is served without authentication.
+type Result struct {
+	Status string `json:"status"`
+}
+
+// Report represents response of readiness request
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Handler handles liveness and readiness probes
+type Handler struct {
+	Checks []Check
+
+	shuttingDown int32
+}
+
+// Shutdown fails readiness from now on so traffic drains before the server stops
+func (h *Handler) Shutdown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// Live handle liveness request, the process is up when it can answer
+func (h *Handler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready handle readiness request, running every check concurrently
+func (h *Handler) Ready(c *gin.Context) {
+	if atomic.LoadInt32(&h.shuttingDown) == 1 {
+		c.JSON(http.StatusServiceUnavailable, Report{Status: StatusShuttingDown})
+		return
+	}
+
+	l := logger.Extract(c)
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.Checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := run(c.Request.Context(), check)
+			result := Result{Status: StatusOK}
+			if err != nil {
+				result.Status = StatusFail
+				l.Warn("readiness check failed", zap.String("check", check.Name),
+					zap.Duration("duration", time.Since(start)), zap.Error(err))
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// run runs check, giving up once its timeout passes even if the check
+// itself ignores the context
+func run(ctx context.Context, check Check) error {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
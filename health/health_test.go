@@ -0,0 +1,90 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/health"
+	"github.com/gin-gonic/gin"
+)
+
+func ready(h *health.Handler) (*httptest.ResponseRecorder, health.Report) {
+	r := gin.New()
+	r.GET("/readyz", h.Ready)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	report := health.Report{}
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	return rec, report
+}
+
+func ok(ctx context.Context) error {
+	return nil
+}
+
+func TestReady(t *testing.T) {
+	h := &health.Handler{
+		Checks: []health.Check{{Name: "sql", Run: ok}, {Name: "redis", Run: ok}},
+	}
+
+	rec, report := ready(h)
+	if rec.Code != http.StatusOK {
+		t.Error("status code is not ok", rec.Code, rec.Body.String())
+	}
+	if len(report.Checks) != 2 || report.Checks["redis"].Status != health.StatusOK {
+		t.Error("want 2 passing checks but get", report.Checks)
+	}
+}
+
+func TestReadyFailingCheck(t *testing.T) {
+	h := &health.Handler{
+		Checks: []health.Check{
+			{Name: "sql", Run: ok},
+			{Name: "redis", Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+			{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+				// ignores ctx like a client without context support
+				time.Sleep(time.Second)
+				return nil
+			}},
+		},
+	}
+
+	start := time.Now()
+	rec, report := ready(h)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("want slow check cut off by its timeout but took", time.Since(start))
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Error("want status", http.StatusServiceUnavailable, "but get", rec.Code)
+	}
+	if report.Checks["sql"].Status != health.StatusOK {
+		t.Error("want sql ok but get", report.Checks["sql"])
+	}
+	if report.Checks["redis"].Status != health.StatusFail || strings.Contains(rec.Body.String(), "connection refused") {
+		t.Error("want redis failed without its error but get", rec.Body.String())
+	}
+	if report.Checks["slow"].Status != health.StatusFail {
+		t.Error("want slow check failed but get", report.Checks["slow"])
+	}
+}
+
+func TestReadyFailsOnShutdown(t *testing.T) {
+	h := &health.Handler{Checks: []health.Check{{Name: "sql", Run: ok}}}
+	h.Shutdown()
+
+	rec, report := ready(h)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Error("want status", http.StatusServiceUnavailable, "after shutdown but get", rec.Code)
+	}
+	if report.Status != health.StatusShuttingDown {
+		t.Error("want status", health.StatusShuttingDown, "but get", report.Status)
+	}
+}
@@ -0,0 +1,188 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/ratelimit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Header is the request header carrying the idempotency key
+const Header = "Idempotency-Key"
+
+// maxKeyLength bounds the keys clients may send
+const maxKeyLength = 255
+
+// replayed lists the response headers stored along with the body
+var replayed = []string{"Content-Type", "ETag", "Location"}
+
+// Response is the stored outcome of the first request with a key
+type Response struct {
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Store keeps responses by key until they expire
+type Store interface {
+	// Reserve saves r for key unless the key is taken, in which case the
+	// stored response is returned instead
+	Reserve(key string, r Response, ttl time.Duration) (*Response, error)
+	// Save replaces the response of a reserved key
+	Save(key string, r Response, ttl time.Duration) error
+	// Release forgets key so the request can be tried again
+	Release(key string) error
+}
+
+// Config represents idempotency settings
+type Config struct {
+	// TTL is how long a response is replayed for
+	TTL time.Duration
+	// LockTTL is how long a request in progress holds its key, so a crash
+	// mid-request only blocks retries that long. It should outlast the
+	// server write timeout.
+	LockTTL time.Duration
+	// Scope separates the keys of different clients, by user by default
+	Scope ratelimit.KeyFunc
+	Store Store
+}
+
+// Middleware return middleware replaying the first response of requests
+// that carry the same Idempotency-Key
+func Middleware(cfg Config) gin.HandlerFunc {
+	if cfg.TTL == 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.LockTTL == 0 {
+		cfg.LockTTL = time.Minute
+	}
+	if cfg.Scope == nil {
+		cfg.Scope = ratelimit.ByUser
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if id == "" {
+			c.Next()
+			return
+		}
+		if len(id) > maxKeyLength {
+			apperror.Abort(c, apperror.BadRequest(Header+" is too long"))
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			apperror.Abort(c, apperror.Wrap(err, apperror.CodeBadRequest, "can't read request body"))
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		key := cfg.Scope(c) + ":" + id
+		fingerprint := fingerprint(c.Request, body)
+
+		existing, err := cfg.Store.Reserve(key, Response{Fingerprint: fingerprint}, cfg.LockTTL)
+		if err != nil {
+			// don't reject traffic because the store is unavailable
+			logger.Extract(c).Warn("idempotency reserve failed", zap.String("key", key), zap.Error(err))
+			c.Next()
+			return
+		}
+		if existing != nil {
+			replay(c, existing, fingerprint)
+			return
+		}
+
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// errors are rendered later by apperror.Middleware and aren't kept,
+		// so clients can retry failures that may succeed next time
+		status := w.Status()
+		if !w.Written() || status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			err = cfg.Store.Release(key)
+		} else {
+			err = cfg.Store.Save(key, Response{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      status,
+				Header:      pick(w.Header()),
+				Body:        w.body.Bytes(),
+			}, cfg.TTL)
+		}
+		if err != nil {
+			logger.Extract(c).Warn("idempotency save failed", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func replay(c *gin.Context, r *Response, fingerprint string) {
+	if r.Fingerprint != fingerprint {
+		apperror.Abort(c, apperror.New(apperror.CodeValidation, Header+" was already used with a different request"))
+		return
+	}
+	if !r.Done {
+		c.Header("Retry-After", "1")
+		apperror.Abort(c, apperror.New(apperror.CodeConflict, "request with this "+Header+" is still in progress"))
+		return
+	}
+
+	for name, values := range r.Header {
+		for _, v := range values {
+			c.Writer.Header().Add(name, v)
+		}
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Status(r.Status)
+	c.Writer.Write(r.Body)
+	c.Abort()
+}
+
+// fingerprint identifies a request by its method, path and body
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func pick(header http.Header) http.Header {
+	picked := http.Header{}
+	for _, name := range replayed {
+		if values := header.Values(name); len(values) > 0 {
+			picked[name] = values
+		}
+	}
+	return picked
+}
+
+// recorder copies the response body while it's written
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
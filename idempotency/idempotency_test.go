@@ -0,0 +1,118 @@
+package idempotency_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+func setupRouter() (*gin.Engine, *int) {
+	calls := 0
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.Use(idempotency.Middleware(idempotency.Config{}))
+	r.POST("/posts", func(c *gin.Context) {
+		calls++
+		if c.Query("fail") == "true" {
+			apperror.Abort(c, apperror.Unavailable(nil))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": calls})
+	})
+	return r, &calls
+}
+
+func post(r *gin.Engine, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotency.Header, key)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestReplay(t *testing.T) {
+	r, calls := setupRouter()
+
+	first := post(r, "/posts", "abc", `{"content":"hello"}`)
+	retry := post(r, "/posts", "abc", `{"content":"hello"}`)
+
+	if *calls != 1 {
+		t.Error("given retry with same key want handler called once but get", *calls)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Error("want replayed", first.Code, first.Body.String(), "but get", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("want Idempotent-Replayed header but get none")
+	}
+
+	post(r, "/posts", "", `{"content":"hello"}`)
+	post(r, "/posts", "", `{"content":"hello"}`)
+	if *calls != 3 {
+		t.Error("given requests without key want handler called 3 times but get", *calls)
+	}
+}
+
+func TestReuseWithDifferentBody(t *testing.T) {
+	r, _ := setupRouter()
+
+	post(r, "/posts", "abc", `{"content":"hello"}`)
+	rec := post(r, "/posts", "abc", `{"content":"other"}`)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Error("given key reused with different body want status", http.StatusUnprocessableEntity, "but get", rec.Code)
+	}
+}
+
+func TestFailureIsNotReplayed(t *testing.T) {
+	r, calls := setupRouter()
+
+	for i := 0; i < 2; i++ {
+		rec := post(r, "/posts?fail=true", "abc", `{}`)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Error("want status", http.StatusServiceUnavailable, "but get", rec.Code)
+		}
+	}
+	if *calls != 2 {
+		t.Error("given failed request want retry to run handler again but get calls", strconv.Itoa(*calls))
+	}
+}
+
+// ttlStore notes the ttl keys are reserved and saved with
+type ttlStore struct {
+	*idempotency.MemoryStore
+	reserved, saved time.Duration
+}
+
+func (s *ttlStore) Reserve(key string, r idempotency.Response, ttl time.Duration) (*idempotency.Response, error) {
+	s.reserved = ttl
+	return s.MemoryStore.Reserve(key, r, ttl)
+}
+
+func (s *ttlStore) Save(key string, r idempotency.Response, ttl time.Duration) error {
+	s.saved = ttl
+	return s.MemoryStore.Save(key, r, ttl)
+}
+
+func TestLockTTL(t *testing.T) {
+	store := &ttlStore{MemoryStore: idempotency.NewMemoryStore()}
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.Use(idempotency.Middleware(idempotency.Config{TTL: time.Hour, LockTTL: 20 * time.Millisecond, Store: store}))
+	r.POST("/posts", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+
+	post(r, "/posts", "abc", `{}`)
+	if store.reserved != 20*time.Millisecond || store.saved != time.Hour {
+		t.Error("want reserved for the lock ttl and saved for the ttl but get", store.reserved, store.saved)
+	}
+}
@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// MemoryStore keeps responses in process memory, suitable for a single instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	responses map[string]entry
+	calls     int
+}
+
+type entry struct {
+	response Response
+	expires  time.Time
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		responses: map[string]entry{},
+	}
+}
+
+// Reserve saves r for key unless the key is taken
+func (s *MemoryStore) Reserve(key string, r Response, ttl time.Duration) (*Response, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop expired keys from time to time so the map doesn't grow forever
+	s.calls++
+	if s.calls%1000 == 0 {
+		for k, e := range s.responses {
+			if now.After(e.expires) {
+				delete(s.responses, k)
+			}
+		}
+	}
+
+	if e, ok := s.responses[key]; ok && now.Before(e.expires) {
+		existing := e.response
+		return &existing, nil
+	}
+	s.responses[key] = entry{response: r, expires: now.Add(ttl)}
+	return nil, nil
+}
+
+// Save replaces the response of key
+func (s *MemoryStore) Save(key string, r Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[key] = entry{response: r, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Release forgets key
+func (s *MemoryStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, key)
+	return nil
+}
+
+// RedisStore shares responses between instances through redis
+type RedisStore struct {
+	Client *redis.Client
+	Prefix string
+}
+
+// Reserve saves r for key unless the key is taken
+func (s *RedisStore) Reserve(key string, r Response, ttl time.Duration) (*Response, error) {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.Client.SetNX(s.Prefix+key, value, ttl).Result()
+	if err != nil || ok {
+		return nil, err
+	}
+
+	stored, err := s.Client.Get(s.Prefix + key).Bytes()
+	if err == redis.Nil {
+		// expired in between, try to take it again
+		return s.Reserve(key, r, ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing := &Response{}
+	if err := json.Unmarshal(stored, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// Save replaces the response of key
+func (s *RedisStore) Save(key string, r Response, ttl time.Duration) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.Client.Set(s.Prefix+key, value, ttl).Err()
+}
+
+// Release forgets key
+func (s *RedisStore) Release(key string) error {
+	return s.Client.Del(s.Prefix + key).Err()
+}
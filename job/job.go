@@ -0,0 +1,38 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Every runs fn every interval until ctx is done, the returned channel is
+// closed once the last run has finished
+func Every(ctx context.Context, logger *zap.Logger, name string, interval time.Duration, fn func(context.Context) error) <-chan struct{} {
+	done := make(chan struct{})
+	l := logger.With(zap.String("job", name))
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t := time.Now()
+				if err := fn(ctx); err != nil {
+					l.Error("job failed", zap.Error(err))
+					continue
+				}
+				l.Debug("job done", zap.Duration("latency", time.Since(t)))
+			}
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,271 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Hook starts and stops a component
+type Hook struct {
+	Name string
+	// Start must not block, a long running component runs in its own
+	// goroutine and reports failing through Manager.Fail
+	Start func(ctx context.Context) error
+	// Stop returns once the component stopped or ctx is done
+	Stop func(ctx context.Context) error
+	// Timeout bounds Stop, the manager's StopTimeout when zero
+	Timeout time.Duration
+}
+
+// Status is how stopping a component went
+type Status struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report lists the status of every component stopped, in stop order
+type Report []Status
+
+// Err joins the errors of components that didn't stop cleanly
+func (r Report) Err() error {
+	failed := []string{}
+	for _, s := range r {
+		if s.Error != "" {
+			failed = append(failed, s.Name+": "+s.Error)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(failed, "; "))
+}
+
+// Manager starts components in the order they were added and stops them in
+// reverse, so a component stops before what it depends on
+type Manager struct {
+	// StopTimeout bounds each Stop without its own timeout, 10s when zero
+	StopTimeout time.Duration
+	// Timeouts override the timeout of hooks by name
+	Timeouts map[string]time.Duration
+	// Timeout bounds the whole shutdown, unbounded when zero
+	Timeout time.Duration
+	Logger  *zap.Logger
+
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+	failed  chan error
+}
+
+func (m *Manager) logger() *zap.Logger {
+	if m.Logger == nil {
+		return zap.NewNop()
+	}
+	return m.Logger
+}
+
+func (m *Manager) failures() chan error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failed == nil {
+		m.failed = make(chan error, 1)
+	}
+	return m.failed
+}
+
+// Append adds h to be started after the hooks already added
+func (m *Manager) Append(h Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, h)
+}
+
+// Start starts every component in order. When one fails the ones already
+// started are stopped and its error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := m.hooks
+	m.mu.Unlock()
+
+	for i, h := range hooks {
+		if h.Start != nil {
+			if err := h.Start(ctx); err != nil {
+				m.setStarted(i)
+				err = fmt.Errorf("starting %s: %w", h.Name, err)
+				m.logger().Error("start failed", zap.String("component", h.Name), zap.Error(err))
+				m.Stop(context.Background())
+				return err
+			}
+		}
+		m.logger().Debug("started", zap.String("component", h.Name))
+	}
+	m.setStarted(len(hooks))
+	return nil
+}
+
+func (m *Manager) setStarted(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started = n
+}
+
+// Fail reports a running component failed, like a server that stopped
+// listening, which makes Wait return so everything is stopped cleanly
+func (m *Manager) Fail(err error) {
+	select {
+	case m.failures() <- err:
+	default:
+		// shutdown is already on its way
+	}
+}
+
+// Wait blocks until one of signals arrives or a component fails, returning
+// the failure
+func (m *Manager) Wait(signals ...os.Signal) error {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, signals...)
+	defer signal.Stop(quit)
+
+	select {
+	case sig := <-quit:
+		m.logger().Info("shutting down", zap.String("signal", sig.String()))
+		return nil
+	case err := <-m.failures():
+		m.logger().Error("shutting down after a component failed", zap.Error(err))
+		return err
+	}
+}
+
+// Stop stops the started components in reverse order, each bounded by its
+// timeout and all of them by Timeout. A component failing to stop doesn't
+// keep the rest from stopping.
+func (m *Manager) Stop(ctx context.Context) Report {
+	m.mu.Lock()
+	hooks := m.hooks[:m.started]
+	m.started = 0
+	m.mu.Unlock()
+
+	if m.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Timeout)
+		defer cancel()
+	}
+
+	report := make(Report, 0, len(hooks))
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		if h.Stop == nil {
+			continue
+		}
+		timeout := h.Timeout
+		if t, ok := m.Timeouts[h.Name]; ok {
+			timeout = t
+		}
+		if timeout == 0 {
+			timeout = m.StopTimeout
+		}
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+
+		status := Status{Name: h.Name}
+		t := time.Now()
+		if err := stop(ctx, h, timeout); err != nil {
+			status.Error = err.Error()
+		}
+		status.Duration = time.Since(t)
+		report = append(report, status)
+
+		if status.Error != "" {
+			m.logger().Error("stop failed", zap.String("component", h.Name), zap.Duration("latency", status.Duration), zap.String("error", status.Error))
+		} else {
+			m.logger().Info("stopped", zap.String("component", h.Name), zap.Duration("latency", status.Duration))
+		}
+	}
+	return report
+}
+
+// stop runs h.Stop, giving up once timeout passes even when Stop ignores
+// its context
+func stop(ctx context.Context, h Hook, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.Stop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up after %s: %w", timeout, ctx.Err())
+	}
+}
+
+// Run starts every component, waits for one of signals or a failure and
+// stops them all, returning what went wrong along the way
+func (m *Manager) Run(signals ...os.Signal) (Report, error) {
+	if err := m.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	cause := m.Wait(signals...)
+
+	report := m.Stop(context.Background())
+	err := report.Err()
+	if err != nil {
+		m.logger().Error("shutdown finished with errors", zap.Any("report", report))
+	} else {
+		m.logger().Info("shutdown complete", zap.Any("report", report))
+	}
+	if cause != nil {
+		return report, cause
+	}
+	return report, err
+}
+
+// Done adapts a component stopped by cancelling its context that closes
+// the returned channel once it's finished, like job.Every
+func Done(name string, run func(ctx context.Context) <-chan struct{}) Hook {
+	var cancel context.CancelFunc
+	var done <-chan struct{}
+	return Hook{
+		Name: name,
+		// it runs past Start, so not under the context of Start
+		Start: func(context.Context) error {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			done = run(ctx)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// Closer adapts a component stopped by Close, like a database or redis
+// client
+func Closer(name string, close func() error) Hook {
+	return Hook{
+		Name: name,
+		Stop: func(ctx context.Context) error {
+			return close()
+		},
+	}
+}
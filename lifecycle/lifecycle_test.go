@@ -0,0 +1,148 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/social-gin/lifecycle"
+)
+
+// recorder adds hooks noting when each starts and stops
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) hook(name string) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: name,
+		Start: func(context.Context) error {
+			r.events = append(r.events, "start "+name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			r.events = append(r.events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestStopsInReverse(t *testing.T) {
+	r := &recorder{}
+	m := &lifecycle.Manager{}
+	m.Append(r.hook("sql"))
+	m.Append(r.hook("jobs"))
+	m.Append(r.hook("http"))
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	report := m.Stop(context.Background())
+
+	want := []string{"start sql", "start jobs", "start http", "stop http", "stop jobs", "stop sql"}
+	if !reflect.DeepEqual(r.events, want) {
+		t.Error("want", want, "but get", r.events)
+	}
+	if len(report) != 3 || report.Err() != nil {
+		t.Error("want 3 clean stops but get", report)
+	}
+}
+
+func TestStartFailureStopsStarted(t *testing.T) {
+	r := &recorder{}
+	m := &lifecycle.Manager{}
+	m.Append(r.hook("sql"))
+	m.Append(lifecycle.Hook{
+		Name:  "http",
+		Start: func(context.Context) error { return errors.New("address in use") },
+		Stop:  func(context.Context) error { t.Error("given failed start want no stop"); return nil },
+	})
+	m.Append(r.hook("never"))
+
+	if err := m.Start(context.Background()); err == nil {
+		t.Error("given failing start want error but get nil")
+	}
+	want := []string{"start sql", "stop sql"}
+	if !reflect.DeepEqual(r.events, want) {
+		t.Error("want", want, "but get", r.events)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	r := &recorder{}
+	m := &lifecycle.Manager{
+		StopTimeout: time.Second,
+		Timeouts:    map[string]time.Duration{"stuck": 20 * time.Millisecond},
+	}
+	m.Append(r.hook("sql"))
+	m.Append(lifecycle.Hook{
+		Name: "stuck",
+		Stop: func(context.Context) error {
+			// ignores its context
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	report := m.Stop(context.Background())
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("given stuck component with 20ms timeout want stop to give up but took", elapsed)
+	}
+	if report.Err() == nil || report[0].Error == "" {
+		t.Error("want stuck reported as failed but get", report)
+	}
+	if report[1].Name != "sql" || report[1].Error != "" {
+		t.Error("given stuck component want sql still stopped but get", report[1])
+	}
+}
+
+func TestRunStopsOnFail(t *testing.T) {
+	r := &recorder{}
+	m := &lifecycle.Manager{}
+	m.Append(r.hook("sql"))
+	m.Append(lifecycle.Hook{
+		Name: "http",
+		Start: func(context.Context) error {
+			go m.Fail(errors.New("listener closed"))
+			return nil
+		},
+	})
+
+	report, err := m.Run(syscall.SIGUSR1)
+	if err == nil || err.Error() != "listener closed" {
+		t.Error("want listener closed but get", err)
+	}
+	if len(report) != 1 || report[0].Name != "sql" {
+		t.Error("want sql stopped but get", report)
+	}
+}
+
+func TestDone(t *testing.T) {
+	stopped := false
+	h := lifecycle.Done("job", func(ctx context.Context) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			<-ctx.Done()
+			stopped = true
+			close(done)
+		}()
+		return done
+	})
+	if err := h.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !stopped {
+		t.Error("want job stopped once Stop returns")
+	}
+}
@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Body configures capture of request and response bodies, meant for
+// debugging as bodies make log lines large
+type Body struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxBytes is the most captured of each body, 4096 when zero
+	MaxBytes int `mapstructure:"max_bytes" validate:"gte=0"`
+}
+
+func (b Body) max() int {
+	if b.MaxBytes <= 0 {
+		return 4096
+	}
+	return b.MaxBytes
+}
+
+// bodyWriter keeps the first max bytes written to the response
+type bodyWriter struct {
+	gin.ResponseWriter
+	buf *bytes.Buffer
+	max int
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyWriter) capture(b []byte) {
+	if room := w.max - w.buf.Len(); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		w.buf.Write(b)
+	}
+}
+
+// captureRequest reads up to max bytes of the request body, one more to
+// tell it was cut, and puts them back so the handler still reads it all
+func captureRequest(c *gin.Context, max int) []byte {
+	if c.Request.Body == nil {
+		return nil
+	}
+	head, _ := ioutil.ReadAll(io.LimitReader(c.Request.Body, int64(max)+1))
+	c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+	return head
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyField logs body by its content type: json and forms are decoded so
+// fields are redacted by name, other text by patterns, binary isn't logged
+func bodyField(key string, r *Redactor, contentType string, body []byte, max int) zap.Field {
+	truncated := len(body) > max
+	if truncated {
+		body = body[:max]
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case len(body) == 0:
+		return zap.Skip()
+	case strings.HasSuffix(mediaType, "json") && !truncated:
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			return zap.Reflect(key, r.Value(v))
+		}
+	case mediaType == "application/x-www-form-urlencoded" && !truncated:
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			form := map[string]interface{}{}
+			for k, v := range values {
+				if r.Field(k) {
+					form[k] = Redacted
+				} else {
+					form[k] = r.String(strings.Join(v, ","))
+				}
+			}
+			return zap.Reflect(key, form)
+		}
+	case !strings.HasPrefix(mediaType, "text/") && !strings.HasSuffix(mediaType, "json") &&
+		!strings.HasSuffix(mediaType, "xml") && mediaType != "application/x-www-form-urlencoded":
+		return zap.String(key, "["+mediaType+" body not logged]")
+	}
+	s := r.String(string(body))
+	if truncated {
+		s += "...[truncated]"
+	}
+	return zap.String(key, s)
+}
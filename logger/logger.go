@@ -1,26 +1,86 @@
 package logger
 
 import (
+	"bytes"
 	"time"
 
+	"example.com/social-gin/requestid"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 const loggerKey = "logger"
 
-// Middleware return middleware function
+// Config configures the request logger
+type Config struct {
+	// Redactor hides secrets in every line logged through the middleware and
+	// Extract, the default rules when nil
+	Redactor *Redactor
+	// Body captures request and response bodies into the request line
+	Body Body
+	// Routes override the level of requests to a route template, like
+	// debug for a route being investigated
+	Routes map[string]zapcore.Level
+	// Skip lists paths or route templates whose request line isn't logged,
+	// lines logged by their handlers still are
+	Skip []string
+}
+
+// Middleware return middleware logging every request under its request id,
+// generated when the client sent none or a malformed one and echoed back
 func Middleware(logger *zap.Logger) gin.HandlerFunc {
+	return MiddlewareWithConfig(logger, Config{})
+}
+
+// MiddlewareWithConfig return middleware like Middleware configured by cfg
+func MiddlewareWithConfig(logger *zap.Logger, cfg Config) gin.HandlerFunc {
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = defaultRedactor
+	}
+	routes := make(map[string]*zap.Logger, len(cfg.Routes))
+	for route, level := range cfg.Routes {
+		routes[route] = WithLevel(logger, level).WithOptions(zap.WrapCore(redactor.Core))
+	}
+	logger = logger.WithOptions(zap.WrapCore(redactor.Core))
+	skip := make(map[string]bool, len(cfg.Skip))
+	for _, path := range cfg.Skip {
+		skip[path] = true
+	}
+	max := cfg.Body.max()
+
 	return func(c *gin.Context) {
 		t := time.Now()
 
-		l := logger.With((zap.String("id", c.GetHeader("X-Request-ID"))))
+		// trust the client's request id only when it's well formed
+		id := requestid.Resolve(c.GetHeader(requestid.Header))
+		c.Header(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+
+		base, ok := routes[c.FullPath()]
+		if !ok {
+			base = logger
+		}
+		l := base.With(zap.String("id", id))
 		c.Set(loggerKey, l)
 
+		var requestBody []byte
+		var response *bodyWriter
+		if cfg.Body.Enabled {
+			requestBody = captureRequest(c, max)
+			response = &bodyWriter{ResponseWriter: c.Writer, buf: &bytes.Buffer{}, max: max + 1}
+			c.Writer = response
+		}
+
 		c.Next()
 
+		if skip[c.Request.URL.Path] || skip[c.FullPath()] {
+			return
+		}
 		latency := time.Since(t)
-		l.Info("request",
+		fields := []zap.Field{
 			zap.Int("status", c.Writer.Status()),
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
@@ -28,15 +88,33 @@ func Middleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("ip", c.ClientIP()),
 			zap.String("user-agent", c.Request.UserAgent()),
 			zap.Duration("latency", latency),
-		)
+		}
+		if cfg.Body.Enabled {
+			fields = append(fields,
+				zap.Reflect("request_headers", redactor.Header(c.Request.Header)),
+				bodyField("request_body", redactor, c.ContentType(), requestBody, max),
+				zap.Reflect("response_headers", redactor.Header(c.Writer.Header())),
+				bodyField("response_body", redactor, c.Writer.Header().Get("Content-Type"), response.buf.Bytes(), max),
+			)
+		}
+		withTrace(c, l).Info("request", fields...)
 	}
 }
 
-// Extract extract zap logger from context
+// Extract extract zap logger from context, with the trace and span id
+// when the request is traced. Outside the middleware it's the global logger.
 func Extract(c *gin.Context) *zap.Logger {
 	l, ok := c.Get(loggerKey)
 	if ok {
-		return l.(*zap.Logger)
+		return withTrace(c, l.(*zap.Logger))
+	}
+	return zap.L().WithOptions(zap.WrapCore(defaultRedactor.Core))
+}
+
+func withTrace(c *gin.Context, l *zap.Logger) *zap.Logger {
+	sc := trace.SpanContextFromContext(c.Request.Context())
+	if !sc.IsValid() {
+		return l
 	}
-	return zap.NewExample()
+	return l.With(zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
 }
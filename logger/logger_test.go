@@ -0,0 +1,141 @@
+package logger_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func serve(cfg logger.Config, h gin.HandlerFunc, req *http.Request) *observer.ObservedLogs {
+	core, logs := observer.New(zap.DebugLevel)
+	r := gin.New()
+	r.Use(logger.MiddlewareWithConfig(zap.New(core), cfg))
+	r.POST("/login", h)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return logs
+}
+
+func TestExtractRedacts(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/login?token=abc123", nil)
+	logs := serve(logger.Config{}, func(c *gin.Context) {
+		l := logger.Extract(c)
+		l.Info("login password=hunter2")
+		l.Info("login", zap.String("password", "hunter2"), zap.String("auth", "Bearer abc.def"))
+	}, req)
+
+	for _, entry := range logs.All() {
+		line := entry.Message
+		for k, v := range entry.ContextMap() {
+			line += fmt.Sprint(" ", k, "=", v)
+		}
+		for _, secret := range []string{"hunter2", "abc123", "abc.def"} {
+			if strings.Contains(line, secret) {
+				t.Error("want", secret, "redacted but get", line)
+			}
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	cfg := logger.Config{Body: logger.Body{Enabled: true, MaxBytes: 64}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"blink","password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer abc")
+
+	var read string
+	logs := serve(cfg, func(c *gin.Context) {
+		b, _ := ioutil.ReadAll(c.Request.Body)
+		read = string(b)
+		c.JSON(http.StatusOK, gin.H{"token": "abc", "message": strings.Repeat("x", 100)})
+	}, req)
+
+	if read != `{"username":"blink","password":"hunter2"}` {
+		t.Error("want handler to read the whole body but get", read)
+	}
+	fields := logs.FilterMessage("request").All()[0].ContextMap()
+
+	body := fields["request_body"].(map[string]interface{})
+	if body["password"] != logger.Redacted || body["username"] != "blink" {
+		t.Error("want password redacted and username kept but get", body)
+	}
+	headers := fields["request_headers"].(map[string]string)
+	if headers["Authorization"] != logger.Redacted {
+		t.Error("want authorization header redacted but get", headers)
+	}
+	response := fields["response_body"].(string)
+	if !strings.HasSuffix(response, "...[truncated]") || strings.Contains(response, `"abc"`) {
+		t.Error("want response truncated with token redacted but get", response)
+	}
+}
+
+func TestBodyDisabled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"password":"hunter2"}`))
+	logs := serve(logger.Config{}, func(c *gin.Context) {}, req)
+
+	if _, ok := logs.FilterMessage("request").All()[0].ContextMap()["request_body"]; ok {
+		t.Error("want no body logged unless enabled")
+	}
+}
+
+func TestRouteLevelAndSkip(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	base := logger.WithLevel(zap.New(core), zap.InfoLevel)
+
+	r := gin.New()
+	r.Use(logger.MiddlewareWithConfig(base, logger.Config{
+		Routes: map[string]zapcore.Level{"/debug/:id": zap.DebugLevel},
+		Skip:   []string{"/healthz"},
+	}))
+	handler := func(c *gin.Context) {
+		logger.Extract(c).Debug("detail")
+	}
+	r.GET("/debug/:id", handler)
+	r.GET("/quiet", handler)
+	r.GET("/healthz", handler)
+
+	for _, path := range []string{"/debug/1", "/quiet", "/healthz"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if n := logs.FilterMessage("detail").Len(); n != 1 {
+		t.Error("want debug logged only on the overridden route but get", n, "lines")
+	}
+	paths := []string{}
+	for _, entry := range logs.FilterMessage("request").All() {
+		paths = append(paths, entry.ContextMap()["path"].(string))
+	}
+	if len(paths) != 2 || paths[0] != "/debug/1" || paths[1] != "/quiet" {
+		t.Error("want request lines of /debug/1 and /quiet but get", paths)
+	}
+}
+
+func TestNew(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.log")
+	l, level, err := logger.New(logger.Options{Level: "warn", Outputs: []logger.Output{{Path: file}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("hidden")
+	level.SetLevel(zap.InfoLevel)
+	l.Info("shown")
+	l.Sync()
+
+	b, _ := ioutil.ReadFile(file)
+	if strings.Contains(string(b), "hidden") || !strings.Contains(string(b), "shown") {
+		t.Error("want only lines at the current level but get", string(b))
+	}
+
+	if _, _, err := logger.New(logger.Options{Level: "loud"}); err == nil {
+		t.Error("want error for unknown level")
+	}
+}
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces every redacted value
+const Redacted = "[REDACTED]"
+
+// DefaultFields are the field names always redacted, p is the password
+// field of the login form
+var DefaultFields = []string{
+	"password", "p", "passwd", "secret", "client_secret",
+	"token", "access_token", "refresh_token", "id_token", "code_verifier",
+	"authorization", "cookie", "set-cookie",
+}
+
+// DefaultHeaders are the header names always redacted
+var DefaultHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// DefaultPatterns match secrets inside free text
+var DefaultPatterns = []string{
+	`(?i)bearer\s+[a-z0-9\-._~+/]+=*`,
+	`(?i)(password|passwd|secret|token)=[^\s&]+`,
+	`(?i)"[a-z_]*(password|secret|token)"\s*:\s*"[^"]*"?`,
+}
+
+// Redactor hides secrets in log lines: values of fields and headers with
+// the listed names, matched case-insensitively, and every match of patterns
+type Redactor struct {
+	fields   map[string]bool
+	headers  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor creates redactor of the default rules plus the given ones
+func NewRedactor(fields, headers, patterns []string) (*Redactor, error) {
+	r := &Redactor{fields: map[string]bool{}, headers: map[string]bool{}}
+	for _, f := range append(append([]string{}, DefaultFields...), fields...) {
+		r.fields[strings.ToLower(f)] = true
+	}
+	for _, h := range append(append([]string{}, DefaultHeaders...), headers...) {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, p := range append(append([]string{}, DefaultPatterns...), patterns...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// defaultRedactor applies the default rules, they always compile
+var defaultRedactor, _ = NewRedactor(nil, nil, nil)
+
+// Field reports values of field name must be hidden
+func (r *Redactor) Field(name string) bool {
+	return r.fields[strings.ToLower(name)]
+}
+
+// String replaces every pattern match in s
+func (r *Redactor) String(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// Value redacts decoded json, hiding fields by name at any depth
+func (r *Redactor) Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if r.Field(k) {
+				out[k] = Redacted
+			} else {
+				out[k] = r.Value(e)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = r.Value(e)
+		}
+		return out
+	case string:
+		return r.String(v)
+	}
+	return v
+}
+
+// Header returns the first value of every header with redacted ones hidden
+func (r *Redactor) Header(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if len(v) == 0 {
+			continue
+		}
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			out[k] = Redacted
+		} else {
+			out[k] = r.String(v[0])
+		}
+	}
+	return out
+}
+
+func (r *Redactor) zapFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch {
+		case r.Field(f.Key):
+			f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: Redacted}
+		case f.Type == zapcore.StringType:
+			f.String = r.String(f.String)
+		case f.Type == zapcore.ReflectType:
+			f.Interface = r.Value(f.Interface)
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// redactCore redacts the message and fields of every entry before the
+// wrapped core encodes them
+type redactCore struct {
+	zapcore.Core
+	r *Redactor
+}
+
+// Core wraps core so everything it writes goes through r
+func (r *Redactor) Core(core zapcore.Core) zapcore.Core {
+	return &redactCore{Core: core, r: r}
+}
+
+func (c *redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.r.zapFields(fields)), r: c.r}
+}
+
+func (c *redactCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.r.String(entry.Message)
+	return c.Core.Write(entry, c.r.zapFields(fields))
+}
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Options configures the base logger
+type Options struct {
+	// Level is the lowest level logged: debug, info, warn or error
+	Level string `mapstructure:"level" validate:"omitempty,oneof=debug info warn error"`
+	// Format is json or console
+	Format string `mapstructure:"format" validate:"omitempty,oneof=json console"`
+	// Sampling keeps the first Initial entries with the same level and
+	// message every second, then every Thereafter-th, off when Initial is 0
+	Sampling struct {
+		Initial    int `mapstructure:"initial" validate:"gte=0"`
+		Thereafter int `mapstructure:"thereafter" validate:"gte=0"`
+	} `mapstructure:"sampling"`
+	// Outputs are written to all at once, stdout when empty
+	Outputs []Output `mapstructure:"outputs" validate:"dive"`
+}
+
+// Output is stdout, stderr or a file rotated by size and age
+type Output struct {
+	Path string `mapstructure:"path"`
+	// MaxSize is the megabytes a file grows to before it's rotated, 100
+	// when zero
+	MaxSize int `mapstructure:"max_size" validate:"gte=0"`
+	// MaxBackups and MaxAge in days bound the rotated files kept, zero
+	// keeps them all
+	MaxBackups int  `mapstructure:"max_backups"`
+	MaxAge     int  `mapstructure:"max_age"`
+	Compress   bool `mapstructure:"compress"`
+}
+
+func (o Output) writer() zapcore.WriteSyncer {
+	switch o.Path {
+	case "", "stdout":
+		return zapcore.Lock(os.Stdout)
+	case "stderr":
+		return zapcore.Lock(os.Stderr)
+	}
+	return zapcore.AddSync(&lumberjack.Logger{
+		Filename:   o.Path,
+		MaxSize:    o.MaxSize,
+		MaxBackups: o.MaxBackups,
+		MaxAge:     o.MaxAge,
+		Compress:   o.Compress,
+	})
+}
+
+// New creates logger of o, its level can be changed at runtime through the
+// returned level
+func New(o Options) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevel()
+	if o.Level != "" {
+		if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+			return nil, level, err
+		}
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	switch o.Format {
+	case "", "json":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case "console":
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return nil, level, fmt.Errorf("unknown log format %q", o.Format)
+	}
+
+	outputs := o.Outputs
+	if len(outputs) == 0 {
+		outputs = []Output{{Path: "stdout"}}
+	}
+	writers := make([]zapcore.WriteSyncer, 0, len(outputs))
+	for _, output := range outputs {
+		writers = append(writers, output.writer())
+	}
+
+	// the core takes everything, level filtering happens in levelCore so
+	// routes can log below the global level
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(writers...), zapcore.DebugLevel)
+	if o.Sampling.Initial > 0 {
+		core = zapcore.NewSampler(core, time.Second, o.Sampling.Initial, o.Sampling.Thereafter)
+	}
+	l := zap.New(&levelCore{Core: core, level: level}, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	return l, level, nil
+}
+
+// levelCore decides on its own which levels the wrapped core writes
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.level.Enabled(entry.Level) {
+		return c.Core.Check(entry, ce)
+	}
+	return ce
+}
+
+// WithLevel returns l logging at level instead of its own. A logger not
+// made by New can only be made quieter.
+func WithLevel(l *zap.Logger, level zapcore.LevelEnabler) *zap.Logger {
+	return l.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if lc, ok := core.(*levelCore); ok {
+			return &levelCore{Core: lc.Core, level: level}
+		}
+		return &levelCore{Core: core, level: level}
+	}))
+}
+
+// RouteLevel overrides the level of requests to Route, a route template
+type RouteLevel struct {
+	Route string `mapstructure:"route" validate:"required"`
+	Level string `mapstructure:"level" validate:"required,oneof=debug info warn error"`
+}
+
+// Routes parses route levels for Config.Routes
+func Routes(levels []RouteLevel) (map[string]zapcore.Level, error) {
+	routes := make(map[string]zapcore.Level, len(levels))
+	for _, rl := range levels {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(rl.Level)); err != nil {
+			return nil, fmt.Errorf("log level of route %s: %w", rl.Route, err)
+		}
+		routes[rl.Route] = level
+	}
+	return routes, nil
+}
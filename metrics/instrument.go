@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const startKey = "metrics:start"
+
+// InstrumentGORM times every query of db through gorm callbacks
+func (m *Metrics) InstrumentGORM(db *gorm.DB) error {
+	before := func(db *gorm.DB) {
+		db.InstanceSet(startKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			v, ok := db.InstanceGet(startKey)
+			if !ok {
+				return
+			}
+			table := db.Statement.Table
+			if table == "" {
+				table = "unknown"
+			}
+			m.queries.WithLabelValues(operation, table).Observe(time.Since(v.(time.Time)).Seconds())
+			if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+				m.queryErrs.WithLabelValues(operation, table).Inc()
+			}
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("metrics:before_create", before),
+		cb.Create().After("gorm:create").Register("metrics:after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", before),
+		cb.Query().After("gorm:query").Register("metrics:after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", before),
+		cb.Update().After("gorm:update").Register("metrics:after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", before),
+		cb.Row().After("gorm:row").Register("metrics:after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstrumentRedis times every command of client, pipelines count as one
+// command named pipeline
+func (m *Metrics) InstrumentRedis(client *redis.Client) {
+	client.WrapProcess(func(process func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			m.observeCommand(strings.ToLower(cmd.Name()), start, err)
+			return err
+		}
+	})
+	client.WrapProcessPipeline(func(process func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := process(cmds)
+			m.observeCommand("pipeline", start, err)
+			return err
+		}
+	})
+}
+
+func (m *Metrics) observeCommand(command string, start time.Time, err error) {
+	m.commands.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	if err != nil && err != redis.Nil {
+		m.cmdErrs.WithLabelValues(command).Inc()
+	}
+}
+
+// RegisterDBStats exports the connection pool stats of db
+func (m *Metrics) RegisterDBStats(db *sql.DB) error {
+	return m.Registry.Register(&dbStatsCollector{db: db})
+}
+
+var (
+	dbMaxOpen      = prometheus.NewDesc("db_pool_max_open_connections", "Maximum open connections.", nil, nil)
+	dbOpen         = prometheus.NewDesc("db_pool_open_connections", "Open connections, in use and idle.", nil, nil)
+	dbInUse        = prometheus.NewDesc("db_pool_in_use_connections", "Connections in use.", nil, nil)
+	dbIdle         = prometheus.NewDesc("db_pool_idle_connections", "Idle connections.", nil, nil)
+	dbWaitCount    = prometheus.NewDesc("db_pool_wait_count_total", "Times a query waited for a connection.", nil, nil)
+	dbWaitDuration = prometheus.NewDesc("db_pool_wait_duration_seconds_total", "Time spent waiting for a connection.", nil, nil)
+)
+
+// dbStatsCollector reads sql.DBStats on every scrape
+type dbStatsCollector struct {
+	db *sql.DB
+}
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{dbMaxOpen, dbOpen, dbInUse, dbIdle, dbWaitCount, dbWaitDuration} {
+		ch <- d
+	}
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
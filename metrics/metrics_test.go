@@ -0,0 +1,43 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := metrics.New()
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/users/:uid", func(c *gin.Context) {
+		c.String(http.StatusOK, "user")
+	})
+	r.GET("/metrics", m.Handler())
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/:uid",status="200"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/:uid"} 2`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Error("want metrics to contain", want, "but get", body)
+		}
+	}
+	if strings.Contains(body, "/users/1") {
+		t.Error("want raw paths kept out of labels but get", body)
+	}
+}
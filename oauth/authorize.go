@@ -0,0 +1,228 @@
+package oauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+const codeTTL = time.Minute
+
+// authRequest represents a validated authorization request
+type authRequest struct {
+	Client      *Client
+	RedirectURI string
+	State       string
+	Scopes      []string
+	Challenge   string
+}
+
+// authCode is stored in redis until the client redeems it
+type authCode struct {
+	ClientID    string   `json:"client_id"`
+	UID         string   `json:"uid"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+	Challenge   string   `json:"challenge"`
+}
+
+// parseAuthRequest validates authorization request parameters, errors are
+// rendered directly until the redirect uri is trusted and redirected after
+func (h *Handler) parseAuthRequest(c *gin.Context) (*authRequest, bool) {
+	client, err := h.findClient(c.Request.FormValue("client_id"))
+	if err != nil {
+		apperror.Abort(c, apperror.Internal(err))
+		return nil, false
+	}
+	if client == nil {
+		apperror.Abort(c, apperror.BadRequest("unknown client"))
+		return nil, false
+	}
+
+	redirectURI := c.Request.FormValue("redirect_uri")
+	if !client.allowsRedirect(redirectURI) {
+		apperror.Abort(c, apperror.BadRequest("redirect uri is not registered for the client"))
+		return nil, false
+	}
+
+	req := &authRequest{
+		Client:      client,
+		RedirectURI: redirectURI,
+		State:       c.Request.FormValue("state"),
+		Challenge:   c.Request.FormValue("code_challenge"),
+	}
+
+	if c.Request.FormValue("response_type") != "code" {
+		redirectError(c, req, "unsupported_response_type")
+		return nil, false
+	}
+	// PKCE is required for every client
+	if req.Challenge == "" || c.Request.FormValue("code_challenge_method") != "S256" {
+		redirectError(c, req, "invalid_request")
+		return nil, false
+	}
+	scopes, ok := client.grantable(c.Request.FormValue("scope"))
+	if !ok {
+		redirectError(c, req, "invalid_scope")
+		return nil, false
+	}
+	req.Scopes = scopes
+
+	return req, true
+}
+
+// Authorize handle authorization request, redirecting straight back to the
+// client when the user already consented or describing the consent to ask for
+func (h *Handler) Authorize(c *gin.Context) {
+	req, ok := h.parseAuthRequest(c)
+	if !ok {
+		return
+	}
+
+	uid, _ := strconv.Atoi(c.GetString("uid"))
+	consent := Consent{}
+	result := h.DB.Where("user_id = ? and client_id = ?", uid, req.Client.ClientID).Limit(1).Find(&consent)
+	if result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
+		return
+	}
+
+	granted := strings.Fields(consent.Scopes)
+	covered := result.RowsAffected > 0
+	for _, s := range req.Scopes {
+		covered = covered && contains(granted, s)
+	}
+	if covered {
+		h.redirectCode(c, req)
+		return
+	}
+
+	scopes := []map[string]interface{}{}
+	for _, s := range req.Scopes {
+		scopes = append(scopes, map[string]interface{}{
+			"scope":       s,
+			"description": Scopes[s],
+		})
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"client_id": req.Client.ClientID,
+		"name":      req.Client.Name,
+		"scopes":    scopes,
+	})
+}
+
+// Consent handle the user answer to a consent request
+func (h *Handler) Consent(c *gin.Context) {
+	req, ok := h.parseAuthRequest(c)
+	if !ok {
+		return
+	}
+
+	if c.Request.FormValue("approve") != "true" {
+		redirectError(c, req, "access_denied")
+		return
+	}
+
+	uid, _ := strconv.Atoi(c.GetString("uid"))
+	consent := Consent{}
+	result := h.DB.Where("user_id = ? and client_id = ?", uid, req.Client.ClientID).Limit(1).Find(&consent)
+	if result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
+		return
+	}
+
+	consent.UserID = uid
+	consent.ClientID = req.Client.ClientID
+	consent.Scopes = strings.Join(normalize(append(strings.Fields(consent.Scopes), req.Scopes...)), " ")
+	if result := h.DB.Save(&consent); result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
+		return
+	}
+
+	h.redirectCode(c, req)
+}
+
+// ListConsent handle list consent request of the login user
+func (h *Handler) ListConsent(c *gin.Context) {
+	consents := []Consent{}
+	if result := h.DB.Where("user_id = ?", c.GetString("uid")).Find(&consents); result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
+		return
+	}
+	c.JSON(http.StatusOK, consents)
+}
+
+// RevokeConsent handle revoke consent request, tokens already issued under
+// the consent are revoked with it
+func (h *Handler) RevokeConsent(c *gin.Context) {
+	uid := c.GetString("uid")
+	result := h.DB.Where("user_id = ? and client_id = ?", uid, c.Param("cid")).Delete(&Consent{})
+	if result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		apperror.Abort(c, apperror.NotFound("consent not found"))
+		return
+	}
+	if err := h.revoke(uid, c.Param("cid")); err != nil {
+		apperror.Abort(c, apperror.Unavailable(err))
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"client_id": c.Param("cid"),
+	})
+}
+
+// redirectCode issues authorization code and sends the user back to the client
+func (h *Handler) redirectCode(c *gin.Context, req *authRequest) {
+	code, err := randomString(32)
+	if err != nil {
+		redirectError(c, req, "server_error")
+		return
+	}
+	value, _ := json.Marshal(authCode{
+		ClientID:    req.Client.ClientID,
+		UID:         c.GetString("uid"),
+		RedirectURI: req.RedirectURI,
+		Scopes:      req.Scopes,
+		Challenge:   req.Challenge,
+	})
+	if _, err := h.RedisClient.Set(codeKey(code), value, codeTTL).Result(); err != nil {
+		redirectError(c, req, "server_error")
+		return
+	}
+
+	q := url.Values{}
+	q.Set("code", code)
+	redirect(c, req, q)
+}
+
+func redirectError(c *gin.Context, req *authRequest, code string) {
+	q := url.Values{}
+	q.Set("error", code)
+	redirect(c, req, q)
+}
+
+func redirect(c *gin.Context, req *authRequest, q url.Values) {
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for k, v := range q {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, u.String())
+}
+
+func codeKey(code string) string {
+	return "oauth:code:" + code
+}
@@ -0,0 +1,263 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"gorm.io/gorm"
+)
+
+// Scopes lists the scopes clients can request and what they allow
+var Scopes = map[string]string{
+	"profile":     "read your profile",
+	"posts:write": "create, update and delete your posts",
+	"users:write": "update and delete your account",
+}
+
+// Client represents third-party application registered by a user
+type Client struct {
+	ID           uint           `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"update_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ClientID     string         `gorm:"size:64;uniqueIndex" json:"client_id"`
+	SecretHash   string         `json:"-"`
+	Name         string         `json:"name"`
+	RedirectURIs string         `json:"redirect_uris"`
+	Scopes       string         `json:"scopes"`
+	Confidential bool           `json:"confidential"`
+	OwnerID      int            `json:"owner_id"`
+}
+
+// Consent records the scopes a user granted to a client
+type Consent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"update_at"`
+	UserID    int       `gorm:"uniqueIndex:idx_consent_client" json:"user_id"`
+	ClientID  string    `gorm:"size:64;uniqueIndex:idx_consent_client" json:"client_id"`
+	Scopes    string    `json:"scopes"`
+}
+
+// GrantIssuer issues access tokens understood by user.Handler.Authorize
+type GrantIssuer interface {
+	IssueGrantToken(grant user.Grant, ttl time.Duration) (string, error)
+}
+
+// ClientRequest represents body of register client request
+type ClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// Handler handles oauth2 authorization server requests
+type Handler struct {
+	DB          *gorm.DB
+	RedisClient *redis.Client
+	Tokens      GrantIssuer
+	TokenTTL    time.Duration
+	// GetTokenTTL, when set, is called for every token instead of TokenTTL
+	// so it can change while serving
+	GetTokenTTL func() time.Duration
+}
+
+// RegisterClient handle register client request
+func (h *Handler) RegisterClient(c *gin.Context) {
+	uid, err := strconv.Atoi(c.GetString("uid"))
+	if err != nil {
+		apperror.Abort(c, apperror.Unauthorized("unauthorized user"))
+		return
+	}
+
+	req := ClientRequest{}
+	if err := validation.Bind(c, &req); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	for _, u := range req.RedirectURIs {
+		if !validRedirectURI(u) {
+			apperror.Abort(c, apperror.BadRequest("invalid redirect uri "+u))
+			return
+		}
+	}
+	for _, s := range req.Scopes {
+		if _, ok := Scopes[s]; !ok {
+			apperror.Abort(c, apperror.BadRequest("unknown scope "+s))
+			return
+		}
+	}
+
+	clientID, err := randomString(16)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal(err))
+		return
+	}
+	client := Client{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		Scopes:       strings.Join(req.Scopes, " "),
+		Confidential: req.Confidential,
+		OwnerID:      uid,
+	}
+	secret := ""
+	if client.Confidential {
+		if secret, err = randomString(32); err != nil {
+			apperror.Abort(c, apperror.Internal(err))
+			return
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if result := h.DB.Create(&client); result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
+		return
+	}
+
+	// the secret is only ever shown once
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"client":        client,
+		"client_secret": secret,
+	})
+}
+
+// findClient looks up client by its public id
+func (h *Handler) findClient(clientID string) (*Client, error) {
+	client := &Client{}
+	result := h.DB.Where("client_id = ?", clientID).Limit(1).Find(client)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return client, nil
+}
+
+func (cl *Client) allowsRedirect(u string) bool {
+	for _, allowed := range strings.Fields(cl.RedirectURIs) {
+		if allowed == u {
+			return true
+		}
+	}
+	return false
+}
+
+func (cl *Client) verifySecret(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(cl.SecretHash), []byte(hashSecret(secret))) == 1
+}
+
+// grantable returns the requested scopes, or all client scopes when none are
+// requested, and false if any of them isn't registered for the client
+func (cl *Client) grantable(requested string) ([]string, bool) {
+	allowed := strings.Fields(cl.Scopes)
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return allowed, true
+	}
+	for _, s := range scopes {
+		if !contains(allowed, s) {
+			return nil, false
+		}
+	}
+	return normalize(scopes), true
+}
+
+func validRedirectURI(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	// plain http is only for local development
+	return u.Scheme == "https" || (u.Scheme == "http" && u.Hostname() == "localhost")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize sorts and de-duplicates scopes
+func normalize(scopes []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range scopes {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns url safe random string of n bytes entropy
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SoftDeleteOwned soft-deletes the clients of a deleted user, consents stay
+// so a restore brings them back
+func (h *Handler) SoftDeleteOwned(tx *gorm.DB, uid uint, at time.Time) error {
+	return tx.Model(&Client{}).Where("owner_id = ? and deleted_at is null", uid).Update("deleted_at", at).Error
+}
+
+// RestoreOwned restores the clients deleted together with their owner
+func (h *Handler) RestoreOwned(tx *gorm.DB, uid uint, at time.Time) error {
+	return tx.Unscoped().Model(&Client{}).Where("owner_id = ? and deleted_at = ?", uid, at).Update("deleted_at", nil).Error
+}
+
+// PurgeOwned hard-deletes the consents and clients of a user, with the
+// consents of other users to those clients and the tokens issued under them
+func (h *Handler) PurgeOwned(tx *gorm.DB, uid uint) error {
+	clients := []string{}
+	if err := tx.Unscoped().Model(&Client{}).Where("owner_id = ?", uid).Pluck("client_id", &clients).Error; err != nil {
+		return err
+	}
+	consents := []Consent{}
+	owned := tx.Where("user_id = ?", uid)
+	if len(clients) > 0 {
+		owned = owned.Or("client_id in ?", clients)
+	}
+	if err := owned.Find(&consents).Error; err != nil {
+		return err
+	}
+	for _, consent := range consents {
+		if err := tx.Delete(&consent).Error; err != nil {
+			return err
+		}
+		if err := h.revoke(strconv.Itoa(consent.UserID), consent.ClientID); err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("owner_id = ?", uid).Delete(&Client{}).Error
+}
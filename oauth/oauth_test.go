@@ -0,0 +1,247 @@
+package oauth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/oauth"
+	"example.com/social-gin/user"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	redirectURI = "https://app.example.com/callback"
+	verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// server is an authorization server of user 7 on sqlite and miniredis
+type server struct {
+	r     *gin.Engine
+	redis *miniredis.Miniredis
+}
+
+func setup(t *testing.T) *server {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&oauth.Client{}, &oauth.Consent{}); err != nil {
+		t.Fatal(err)
+	}
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	h := &oauth.Handler{
+		DB:          db,
+		RedisClient: client,
+		Tokens:      &user.Handler{RedisClient: client},
+	}
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.POST("/oauth/token", h.Token)
+	o := r.Group("/oauth", func(c *gin.Context) { c.Set("uid", "7") })
+	o.POST("/clients", h.RegisterClient)
+	o.POST("/authorize", h.Consent)
+	o.DELETE("/consents/:cid", h.RevokeConsent)
+	return &server{r: r, redis: mr}
+}
+
+func (s *server) do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.r.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *server) form(path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// register creates a client of scopes, returning its id and secret
+func (s *server) register(t *testing.T, confidential bool, scopes ...string) (string, string) {
+	body, _ := json.Marshal(oauth.ClientRequest{
+		Name:         "app",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       scopes,
+		Confidential: confidential,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/oauth/clients", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := s.do(req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("register client want 200 but get", rec.Code, rec.Body.String())
+	}
+	resp := struct {
+		Client       oauth.Client `json:"client"`
+		ClientSecret string       `json:"client_secret"`
+	}{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp.Client.ClientID, resp.ClientSecret
+}
+
+// authorize consents to scope for clientID, returning the redirect query
+func (s *server) authorize(t *testing.T, clientID, scope string) url.Values {
+	sum := sha256.Sum256([]byte(verifier))
+	rec := s.form("/oauth/authorize", url.Values{
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+		"approve":               {"true"},
+	})
+	if rec.Code != http.StatusFound {
+		t.Fatal("consent want 302 but get", rec.Code, rec.Body.String())
+	}
+	u, _ := url.Parse(rec.Header().Get("Location"))
+	return u.Query()
+}
+
+func exchange(clientID, code, verifier, redirect string) url.Values {
+	return url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirect},
+	}
+}
+
+// tokenResponse returns the error or the access token and scope
+func tokenResponse(rec *httptest.ResponseRecorder) map[string]interface{} {
+	resp := map[string]interface{}{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestCodeExchange(t *testing.T) {
+	s := setup(t)
+	clientID, _ := s.register(t, false, "profile", "posts:write")
+	q := s.authorize(t, clientID, "profile")
+	if q.Get("state") != "xyz" || q.Get("code") == "" {
+		t.Fatal("want code and state in redirect but get", q)
+	}
+
+	rec := s.form("/oauth/token", exchange(clientID, q.Get("code"), verifier, redirectURI))
+	if rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	resp := tokenResponse(rec)
+	if resp["scope"] != "profile" {
+		t.Error("given consent to profile want token narrowed to profile but get", resp["scope"])
+	}
+
+	rec = s.form("/oauth/token", exchange(clientID, q.Get("code"), verifier, redirectURI))
+	if rec.Code != http.StatusBadRequest || tokenResponse(rec)["error"] != "invalid_grant" {
+		t.Error("given reused code want invalid_grant but get", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCodeExchangeMismatch(t *testing.T) {
+	s := setup(t)
+	clientID, _ := s.register(t, false, "profile")
+	otherID, _ := s.register(t, false, "profile")
+
+	for name, form := range map[string]func(code string) url.Values{
+		"verifier":     func(code string) url.Values { return exchange(clientID, code, "wrong", redirectURI) },
+		"redirect uri": func(code string) url.Values { return exchange(clientID, code, verifier, redirectURI+"/other") },
+		"client":       func(code string) url.Values { return exchange(otherID, code, verifier, redirectURI) },
+	} {
+		code := s.authorize(t, clientID, "").Get("code")
+		rec := s.form("/oauth/token", form(code))
+		if rec.Code != http.StatusBadRequest || tokenResponse(rec)["error"] != "invalid_grant" {
+			t.Error("given mismatched", name, "want invalid_grant but get", rec.Code, rec.Body.String())
+		}
+		// a failed exchange still burns the code
+		rec = s.form("/oauth/token", exchange(clientID, code, verifier, redirectURI))
+		if rec.Code != http.StatusBadRequest {
+			t.Error("given code after failed exchange want 400 but get", rec.Code)
+		}
+	}
+}
+
+func TestAuthorizeRejects(t *testing.T) {
+	s := setup(t)
+	clientID, _ := s.register(t, false, "profile")
+
+	rec := s.form("/oauth/authorize", url.Values{
+		"client_id":     {clientID},
+		"redirect_uri":  {"https://evil.example.com/callback"},
+		"response_type": {"code"},
+	})
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+		t.Error("given unregistered redirect uri want 400 without redirect but get", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if q := s.authorize(t, clientID, "profile users:write"); q.Get("error") != "invalid_scope" {
+		t.Error("given scope not registered for the client want invalid_scope but get", q)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	s := setup(t)
+	clientID, secret := s.register(t, true, "profile", "posts:write")
+
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"profile"}}
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, "wrong")
+	rec := s.do(req)
+	if rec.Code != http.StatusUnauthorized || tokenResponse(rec)["error"] != "invalid_client" {
+		t.Error("given wrong secret want invalid_client but get", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, secret)
+	rec = s.do(req)
+	if rec.Code != http.StatusOK || tokenResponse(rec)["scope"] != "profile" {
+		t.Error("given secret and narrower scope want profile token but get", rec.Code, rec.Body.String())
+	}
+
+	publicID, _ := s.register(t, false, "profile")
+	form.Set("client_id", publicID)
+	rec = s.form("/oauth/token", form)
+	if rec.Code != http.StatusUnauthorized || tokenResponse(rec)["error"] != "unauthorized_client" {
+		t.Error("given public client want unauthorized_client but get", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRevokeConsent(t *testing.T) {
+	s := setup(t)
+	clientID, _ := s.register(t, false, "profile")
+	code := s.authorize(t, clientID, "profile").Get("code")
+	rec := s.form("/oauth/token", exchange(clientID, code, verifier, redirectURI))
+	token, _ := tokenResponse(rec)["access_token"].(string)
+	if !s.redis.Exists(token) {
+		t.Fatal("want issued token stored but get", rec.Body.String())
+	}
+
+	rec = s.do(httptest.NewRequest(http.MethodDelete, "/oauth/consents/"+clientID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	if s.redis.Exists(token) {
+		t.Error("given revoked consent want its token deleted")
+	}
+}
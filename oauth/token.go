@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+// tokenError renders RFC 6749 section 5.2 error response
+func tokenError(c *gin.Context, status int, code, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, map[string]interface{}{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// authenticateClient identifies the client by basic auth or form credentials
+func (h *Handler) authenticateClient(c *gin.Context) (*Client, bool) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form encodes credentials in the basic header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = c.Request.FormValue("client_id")
+		secret = c.Request.FormValue("client_secret")
+	}
+
+	client, err := h.findClient(clientID)
+	if err != nil {
+		tokenError(c, http.StatusInternalServerError, "server_error", "can't look up client")
+		return nil, false
+	}
+	if client == nil || (client.Confidential && !client.verifySecret(secret)) {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		tokenError(c, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+// Token handle token request for authorization_code and client_credentials grants
+func (h *Handler) Token(c *gin.Context) {
+	client, ok := h.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	var grant user.Grant
+	switch c.Request.FormValue("grant_type") {
+	case "authorization_code":
+		grant, ok = h.redeemCode(c, client)
+	case "client_credentials":
+		grant, ok = clientCredentials(c, client)
+	default:
+		tokenError(c, http.StatusBadRequest, "unsupported_grant_type", "grant type is not supported")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	ttl := h.TokenTTL
+	if h.GetTokenTTL != nil {
+		ttl = h.GetTokenTTL()
+	}
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	token, err := h.Tokens.IssueGrantToken(grant, ttl)
+	if err != nil {
+		tokenError(c, http.StatusInternalServerError, "server_error", "can't issue token")
+		return
+	}
+	// tokens acting for a user end with their consent
+	if grant.UID != "" {
+		if err := h.track(grant, token, ttl); err != nil {
+			tokenError(c, http.StatusInternalServerError, "server_error", "can't issue token")
+			return
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl.Seconds()),
+		"scope":        strings.Join(grant.Scopes, " "),
+	})
+}
+
+// track remembers token under the consent it was issued for, the set lives
+// as long as its longest token
+func (h *Handler) track(grant user.Grant, token string, ttl time.Duration) error {
+	key := tokensKey(grant.UID, grant.ClientID)
+	if err := h.RedisClient.SAdd(key, token).Err(); err != nil {
+		return err
+	}
+	left, err := h.RedisClient.TTL(key).Result()
+	if err != nil {
+		return err
+	}
+	if left < ttl {
+		return h.RedisClient.Expire(key, ttl).Err()
+	}
+	return nil
+}
+
+// revoke deletes the tokens issued to client for uid
+func (h *Handler) revoke(uid, clientID string) error {
+	key := tokensKey(uid, clientID)
+	tokens, err := h.RedisClient.SMembers(key).Result()
+	if err != nil {
+		return err
+	}
+	return h.RedisClient.Del(append(tokens, key)...).Err()
+}
+
+func tokensKey(uid, clientID string) string {
+	return "oauth:tokens:" + uid + ":" + clientID
+}
+
+func (h *Handler) redeemCode(c *gin.Context, client *Client) (user.Grant, bool) {
+	key := codeKey(c.Request.FormValue("code"))
+
+	// read and delete at once so a code can only be redeemed one time
+	var get *redis.StringCmd
+	_, err := h.RedisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err == redis.Nil {
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+		return user.Grant{}, false
+	}
+	if err != nil {
+		tokenError(c, http.StatusInternalServerError, "server_error", "can't read authorization code")
+		return user.Grant{}, false
+	}
+
+	code := authCode{}
+	if err := json.Unmarshal([]byte(get.Val()), &code); err != nil {
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+		return user.Grant{}, false
+	}
+
+	sum := sha256.Sum256([]byte(c.Request.FormValue("code_verifier")))
+	switch {
+	case code.ClientID != client.ClientID:
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client")
+	case code.RedirectURI != c.Request.FormValue("redirect_uri"):
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "redirect uri does not match")
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != code.Challenge:
+		tokenError(c, http.StatusBadRequest, "invalid_grant", "code verifier does not match")
+	default:
+		return user.Grant{
+			UID:      code.UID,
+			ClientID: client.ClientID,
+			Scopes:   code.Scopes,
+		}, true
+	}
+	return user.Grant{}, false
+}
+
+func clientCredentials(c *gin.Context, client *Client) (user.Grant, bool) {
+	if !client.Confidential {
+		tokenError(c, http.StatusUnauthorized, "unauthorized_client", "public clients can't use client credentials")
+		return user.Grant{}, false
+	}
+	scopes, ok := client.grantable(c.Request.FormValue("scope"))
+	if !ok {
+		tokenError(c, http.StatusBadRequest, "invalid_scope", "scope is not registered for the client")
+		return user.Grant{}, false
+	}
+	// the token acts as the client itself, it has no user
+	return user.Grant{
+		ClientID: client.ClientID,
+		Scopes:   scopes,
+	}, true
+}
@@ -0,0 +1,233 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const stateCookie = "oidc_state"
+
+// Identity links a provider subject to a user
+type Identity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"update_at"`
+	Issuer    string    `gorm:"size:255;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_identity_subject" json:"subject"`
+	UserID    uint      `json:"user_id"`
+	User      user.User `json:"-"`
+	Email     string    `json:"email"`
+}
+
+// TokenIssuer issues our access token for a signed in user
+type TokenIssuer interface {
+	IssueToken(uid uint) (string, error)
+}
+
+// Handler handles sign in with external identity providers
+type Handler struct {
+	DB        *gorm.DB
+	Tokens    TokenIssuer
+	Providers map[string]*Provider
+}
+
+// Login redirects the user to the provider sign in page
+func (h *Handler) Login(c *gin.Context) {
+	p, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		apperror.Abort(c, apperror.NotFound("unknown identity provider"))
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		s, err := randomString(32)
+		if err != nil {
+			apperror.Abort(c, apperror.Internal(err))
+			return
+		}
+		values[i] = s
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	u, err := p.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		apperror.Abort(c, apperror.Wrap(err, apperror.CodeBadGateway, "identity provider is unavailable"))
+		return
+	}
+
+	// the state cookie only goes back to us, so it can carry the verifier
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, strings.Join(values[:], "."), 600, "/auth/", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, u)
+}
+
+// Callback completes the sign in, creating the user on first login
+func (h *Handler) Callback(c *gin.Context) {
+	l := logger.Extract(c)
+
+	p, ok := h.Providers[c.Param("provider")]
+	if !ok {
+		apperror.Abort(c, apperror.NotFound("unknown identity provider"))
+		return
+	}
+
+	if e := c.Query("error"); e != "" {
+		apperror.Abort(c, apperror.Wrap(errors.New(e), apperror.CodeUnauthorized, "sign in was rejected by the identity provider"))
+		return
+	}
+
+	cookie, _ := c.Cookie(stateCookie)
+	c.SetCookie(stateCookie, "", -1, "/auth/", "", c.Request.TLS != nil, true)
+
+	values := strings.Split(cookie, ".")
+	if len(values) != 3 || values[0] != c.Query("state") {
+		apperror.Abort(c, apperror.BadRequest("invalid state"))
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	claims, err := p.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce)
+	if err != nil {
+		apperror.Abort(c, apperror.Wrap(err, apperror.CodeUnauthorized, "sign in with identity provider failed"))
+		return
+	}
+
+	identity, err := h.link(claims)
+	if err == errUserDeleted {
+		apperror.Abort(c, apperror.Unauthorized("user is deleted, restore it to sign in"))
+		return
+	} else if err != nil {
+		apperror.Abort(c, apperror.Internal(err))
+		return
+	}
+
+	token, err := h.Tokens.IssueToken(identity.UserID)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal(err))
+		return
+	}
+
+	l.Info("oidc login", zap.String("issuer", identity.Issuer), zap.Uint("uid", identity.UserID))
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"token": token,
+	})
+}
+
+// errUserDeleted is returned when the identity belongs to a deleted user
+var errUserDeleted = errors.New("user of the identity is deleted")
+
+// link finds the identity of claims, creating its user when it's new
+func (h *Handler) link(claims *Claims) (*Identity, error) {
+	identity := &Identity{}
+	result := h.DB.Where("issuer = ? and subject = ?", claims.Issuer, claims.Subject).Limit(1).Find(identity)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		// a deleted user signs in again only once restored
+		var count int64
+		if err := h.DB.Model(&user.User{}).Where("id = ?", identity.UserID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, errUserDeleted
+		}
+		return identity, nil
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		username, err := availableUsername(tx, claims)
+		if err != nil {
+			return err
+		}
+
+		u := user.User{
+			Username: username,
+			// the account has no password, make it impossible to guess one
+			Password: uuid.New().String(),
+			Name:     claims.Name,
+			Email:    claims.Email,
+		}
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+
+		identity = &Identity{
+			Issuer:  claims.Issuer,
+			Subject: claims.Subject,
+			UserID:  u.ID,
+			Email:   claims.Email,
+		}
+		return tx.Create(identity).Error
+	})
+	return identity, err
+}
+
+var usernameInvalid = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// maxUsername is the longest username users can pick themselves
+const maxUsername = 32
+
+// availableUsername derives a free username from the provider profile
+func availableUsername(tx *gorm.DB, claims *Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = usernameInvalid.ReplaceAllString(strings.ToLower(base), "")
+	if base == "" {
+		base = "user"
+	}
+
+	username := cut(base, maxUsername)
+	for i := 0; i < 5; i++ {
+		// deleted users keep their username until purged
+		var count int64
+		if err := tx.Unscoped().Model(&user.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		suffix := "-" + uuid.New().String()[:8]
+		username = cut(base, maxUsername-len(suffix)) + suffix
+	}
+	return "", errors.New("can't find available username")
+}
+
+// cut shortens s to n bytes, usernames are ascii
+func cut(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// SoftDeleteOwned keeps the identities of a deleted user, signing in with
+// them is refused until the user is restored
+func (h *Handler) SoftDeleteOwned(tx *gorm.DB, uid uint, at time.Time) error {
+	return nil
+}
+
+// RestoreOwned has nothing to restore, the identities were kept
+func (h *Handler) RestoreOwned(tx *gorm.DB, uid uint, at time.Time) error {
+	return nil
+}
+
+// PurgeOwned hard-deletes the identities of a user
+func (h *Handler) PurgeOwned(tx *gorm.DB, uid uint) error {
+	return tx.Where("user_id = ?", uid).Delete(&Identity{}).Error
+}
@@ -0,0 +1,127 @@
+package oidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// tokens issues the same token to every user
+type tokens struct{}
+
+func (tokens) IssueToken(uid uint) (string, error) {
+	return "token", nil
+}
+
+// signIn serves sign in through the stub provider on sqlite
+type signIn struct {
+	db       *gorm.DB
+	provider *stubProvider
+	r        *gin.Engine
+}
+
+func setupSignIn(t *testing.T) *signIn {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&user.User{}, &oidc.Identity{}); err != nil {
+		t.Fatal(err)
+	}
+	s := newStubProvider(t)
+	t.Cleanup(s.Close)
+
+	h := &oidc.Handler{
+		DB:        db,
+		Tokens:    tokens{},
+		Providers: map[string]*oidc.Provider{"stub": newProvider(s)},
+	}
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.GET("/auth/:provider", h.Login)
+	r.GET("/auth/:provider/callback", h.Callback)
+	return &signIn{db: db, provider: s, r: r}
+}
+
+// login signs in through the provider, returning the callback response
+func (s *signIn) login(t *testing.T) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/stub", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatal("want redirect to provider but get", rec.Code, rec.Body.String())
+	}
+	u, _ := url.Parse(rec.Header().Get("Location"))
+	s.provider.challenge = u.Query().Get("code_challenge")
+	s.provider.nonce = u.Query().Get("nonce")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/stub/callback?code=code&state="+u.Query().Get("state"), nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec = httptest.NewRecorder()
+	s.r.ServeHTTP(rec, req)
+	return rec
+}
+
+// user returns the user linked to subject
+func (s *signIn) user(t *testing.T, subject string) user.User {
+	identity := oidc.Identity{}
+	if err := s.db.Where("subject = ?", subject).First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	u := user.User{}
+	s.db.Unscoped().First(&u, identity.UserID)
+	return u
+}
+
+func TestCallbackPicksFreeUsername(t *testing.T) {
+	s := setupSignIn(t)
+	deleted := user.User{Username: "blink", Password: "password", Email: "blink@example.com"}
+	s.db.Create(&deleted)
+	s.db.Delete(&deleted)
+
+	if rec := s.login(t); rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	if u := s.user(t, "subject-1"); u.Username == "blink" || !strings.HasPrefix(u.Username, "blink-") {
+		t.Error("given username of a deleted user want blink with a suffix but get", u.Username)
+	}
+
+	s.provider.subject = "subject-2"
+	s.provider.username = strings.Repeat("long", 10)
+	if rec := s.login(t); rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	if u := s.user(t, "subject-2"); u.Username != strings.Repeat("long", 8) {
+		t.Error("given 40 character username want it cut to 32 but get", u.Username)
+	}
+
+	s.provider.subject = "subject-3"
+	rec := s.login(t)
+	if u := s.user(t, "subject-3"); rec.Code != http.StatusOK || len(u.Username) != 32 || !strings.HasPrefix(u.Username, "longlong") {
+		t.Error("given cut username taken want 32 characters with a suffix but get", rec.Code, u.Username)
+	}
+}
+
+func TestCallbackRejectsDeletedUser(t *testing.T) {
+	s := setupSignIn(t)
+	if rec := s.login(t); rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	s.db.Delete(&user.User{}, s.user(t, "subject-1").ID)
+
+	if rec := s.login(t); rec.Code != http.StatusUnauthorized {
+		t.Error("given identity of a deleted user want 401 but get", rec.Code, rec.Body.String())
+	}
+}
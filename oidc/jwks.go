@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshInterval bounds how often unknown key ids refetch the keys, so
+// tokens with made up key ids can't make the server hammer the provider
+const refreshInterval = time.Minute
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// keySet caches the provider signing keys, refetching them when a token
+// references an unknown key id so provider key rotation just works
+type keySet struct {
+	uri string
+	get func(ctx context.Context, u string, v interface{}) error
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+	// fetching lets one request at a time fetch, requests with known keys
+	// don't wait for it
+	fetching sync.Mutex
+}
+
+// verify checks a RS256 signed jwt and returns its payload
+func (s *keySet) verify(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("oidc id token is malformed")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, errors.New("oidc id token uses unsupported algorithm " + header.Alg)
+	}
+
+	key, err := s.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("oidc id token signature is invalid")
+	}
+
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+func (s *keySet) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if key, _, ok := s.cached(kid); ok {
+		return key, nil
+	}
+
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+	// the keys may have been fetched while waiting
+	key, fetched, ok := s.cached(kid)
+	if ok {
+		return key, nil
+	}
+	if time.Since(fetched) < refreshInterval {
+		return nil, errors.New("oidc id token signed by unknown key " + kid)
+	}
+
+	keys, err := s.fetch(ctx)
+	s.mu.Lock()
+	// a failed fetch waits the interval too, a provider that's down isn't
+	// asked on every login
+	s.fetched = time.Now()
+	if err == nil {
+		s.keys = keys
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("oidc id token signed by unknown key " + kid)
+}
+
+// cached returns the key of kid and when the keys were last fetched
+func (s *keySet) cached(kid string) (*rsa.PublicKey, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[kid]
+	return key, s.fetched, ok
+}
+
+// fetch gets the signing keys of the provider
+func (s *keySet) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := s.get(ctx, s.uri, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
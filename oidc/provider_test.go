@@ -0,0 +1,231 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"example.com/social-gin/oidc"
+)
+
+// stubProvider is a minimal OpenID Connect issuer
+type stubProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	signer    *rsa.PrivateKey
+	challenge string
+	nonce     string
+	// kid is the key id of id tokens, k1 when empty
+	kid string
+	// subject and username are claimed by id tokens, subject-1 and blink
+	// when empty
+	subject  string
+	username string
+	// jwks counts the key set requests
+	jwks int
+}
+
+func newStubProvider(t *testing.T) *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubProvider{key: key, signer: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.jwks++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]interface{}{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"id_token":     s.idToken(t),
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *stubProvider) idToken(t *testing.T) string {
+	kid := s.kid
+	if kid == "" {
+		kid = "k1"
+	}
+	header, _ := json.Marshal(map[string]interface{}{"alg": "RS256", "kid": kid})
+	subject, username := s.subject, s.username
+	if subject == "" {
+		subject = "subject-1"
+	}
+	if username == "" {
+		username = "blink"
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":                s.URL,
+		"sub":                subject,
+		"aud":                "client",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              s.nonce,
+		"email":              "blink@email.com",
+		"preferred_username": username,
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// authorize plays the user consenting at the provider
+func (s *stubProvider) authorize(t *testing.T, p *oidc.Provider, nonce, verifier string) {
+	u, err := p.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(u)
+	q := parsed.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Error("want code_challenge_method S256 but get", q.Get("code_challenge_method"))
+	}
+	s.challenge = q.Get("code_challenge")
+	s.nonce = q.Get("nonce")
+}
+
+func newProvider(s *stubProvider) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       s.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/stub/callback",
+	})
+}
+
+func TestExchange(t *testing.T) {
+	s := newStubProvider(t)
+	defer s.Close()
+	p := newProvider(s)
+
+	s.authorize(t, p, "nonce", "verifier")
+
+	claims, err := p.Exchange(context.Background(), "code", "verifier", "nonce")
+	if err != nil {
+		t.Error("want no error but get", err)
+		return
+	}
+
+	want := "subject-1"
+	get := claims.Subject
+	if get != want {
+		t.Error("want subject", want, "but get", get)
+	}
+
+	want = "blink"
+	get = claims.PreferredUsername
+	if get != want {
+		t.Error("want preferred username", want, "but get", get)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	s := newStubProvider(t)
+	defer s.Close()
+	p := newProvider(s)
+
+	s.authorize(t, p, "nonce", "verifier")
+
+	if _, err := p.Exchange(context.Background(), "code", "other", "nonce"); err == nil {
+		t.Error("given wrong code verifier want error but get none")
+	}
+}
+
+func TestExchangeWrongNonce(t *testing.T) {
+	s := newStubProvider(t)
+	defer s.Close()
+	p := newProvider(s)
+
+	s.authorize(t, p, "nonce", "verifier")
+
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "replayed"); err == nil {
+		t.Error("given wrong nonce want error but get none")
+	}
+}
+
+func TestExchangeForgedSignature(t *testing.T) {
+	s := newStubProvider(t)
+	defer s.Close()
+	p := newProvider(s)
+
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.signer = forger
+
+	s.authorize(t, p, "nonce", "verifier")
+
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "nonce"); err == nil {
+		t.Error("given id token signed by unknown key want error but get none")
+	}
+}
+
+func TestExchangeUnknownKeyRefetchLimited(t *testing.T) {
+	s := newStubProvider(t)
+	defer s.Close()
+	p := newProvider(s)
+
+	s.authorize(t, p, "nonce", "verifier")
+	if _, err := p.Exchange(context.Background(), "code", "verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kid := range []string{"random-1", "random-2", "random-3"} {
+		s.kid = kid
+		if _, err := p.Exchange(context.Background(), "code", "verifier", "nonce"); err == nil {
+			t.Error("given unknown key id", kid, "want error but get none")
+		}
+	}
+	if s.jwks != 1 {
+		t.Error("given unknown key ids within a minute want keys fetched once but get", s.jwks)
+	}
+}
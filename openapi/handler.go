@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// Spec serves the document as json
+func Spec(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// asset is a swagger ui file embedded in the binary
+type asset struct {
+	ContentType string
+	Data        []byte
+	// Integrity lets the page check the file it loads
+	Integrity string
+}
+
+// assets are the swagger ui files the docs page loads
+var assets = map[string]*asset{
+	"swagger-ui.css":       {ContentType: "text/css; charset=utf-8"},
+	"swagger-ui-bundle.js": {ContentType: "text/javascript; charset=utf-8"},
+}
+
+func init() {
+	for name, a := range assets {
+		data, err := fs.ReadFile(swaggerFiles.FS, name)
+		if err != nil {
+			panic(err)
+		}
+		sum := sha512.Sum384(data)
+		a.Data = data
+		a.Integrity = "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+}
+
+// Assets serves the swagger ui files of the docs page from the binary, so
+// the page runs no code from elsewhere
+func Assets(c *gin.Context) {
+	a, ok := assets[strings.TrimPrefix(c.Param("file"), "/")]
+	if !ok {
+		apperror.Abort(c, apperror.NotFound("asset not found"))
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, a.ContentType, a.Data)
+}
+
+// ui is the docs page, assets is where Assets is served
+var ui = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>{{.Title}}</title>
+	<link rel="stylesheet" href="{{.Assets}}/swagger-ui.css" integrity="{{.CSSIntegrity}}">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="{{.Assets}}/swagger-ui-bundle.js" integrity="{{.JSIntegrity}}"></script>
+	<script nonce="{{.Nonce}}">
+		window.onload = function () {
+			SwaggerUIBundle({ url: {{.URL}}, dom_id: "#swagger-ui" });
+		};
+	</script>
+</body>
+</html>
+`))
+
+// uiPolicy lets the docs page load swagger ui from this server and run
+// only the inline script carrying the nonce, swagger ui sets inline styles
+const uiPolicy = "default-src 'none'; " +
+	"script-src 'self' 'nonce-%s'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+
+// UI serves the interactive docs of the document at specURL, with the
+// swagger ui files served by Assets under assetsURL
+func UI(title, specURL, assetsURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			apperror.Abort(c, apperror.Internal(err))
+			return
+		}
+		nonce := base64.RawURLEncoding.EncodeToString(b)
+
+		var page bytes.Buffer
+		err := ui.Execute(&page, map[string]string{
+			"Title":        title,
+			"URL":          specURL,
+			"Assets":       assetsURL,
+			"CSSIntegrity": assets["swagger-ui.css"].Integrity,
+			"JSIntegrity":  assets["swagger-ui-bundle.js"].Integrity,
+			"Nonce":        nonce,
+		})
+		if err != nil {
+			apperror.Abort(c, apperror.Internal(err))
+			return
+		}
+
+		c.Header("Content-Security-Policy", fmt.Sprintf(uiPolicy, nonce))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+	}
+}
@@ -0,0 +1,48 @@
+package openapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestUI(t *testing.T) {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.GET("/docs", openapi.UI("API", "/openapi.json", "/docs/assets"))
+	r.GET("/docs/assets/*file", openapi.Assets)
+
+	rec := get(r, "/docs")
+	policy := rec.Header().Get("Content-Security-Policy")
+	if strings.Contains(policy, "http") {
+		t.Error("want policy allowing no other origin but get", policy)
+	}
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(policy)
+	if nonce == nil || !strings.Contains(rec.Body.String(), `nonce="`+nonce[1]+`"`) {
+		t.Error("want inline script carrying the nonce of", policy, "but get", rec.Body.String())
+	}
+	if again := get(r, "/docs").Header().Get("Content-Security-Policy"); again == policy {
+		t.Error("want a new nonce on every page but get the same twice")
+	}
+
+	for _, path := range regexp.MustCompile(`(?:src|href)="(/docs/assets/[^"]+)" integrity="sha384-`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		if asset := get(r, path[1]); asset.Code != http.StatusOK || asset.Body.Len() == 0 {
+			t.Error("given page asset", path[1], "want it served but get", asset.Code)
+		}
+	}
+	if rec := get(r, "/docs/assets/swagger-ui.js.map"); rec.Code != http.StatusNotFound {
+		t.Error("given file the page doesn't load want 404 but get", rec.Code)
+	}
+}
@@ -0,0 +1,240 @@
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version of the documents built here
+const Version = "3.0.3"
+
+// Route documents one endpoint registered on the router
+type Route struct {
+	Method string
+	// Path is the gin path, like /users/:uid
+	Path    string
+	Summary string
+	Tag     string
+	// Auth marks routes that need a bearer token or session cookie, Scope
+	// is the scope a third-party token must carry
+	Auth  bool
+	Scope string
+	// Query lists the query parameters the route reads
+	Query []string
+	// Request is a value of the body type or a *Schema
+	Request interface{}
+	// RequestType of the body, application/json by default
+	RequestType string
+	// Status is the success status, 200 by default
+	Status int
+	// Response is a value of the response type or a *Schema, nil for none
+	Response interface{}
+	// ContentType of the response, application/json by default
+	ContentType string
+	// Deprecated marks routes of a deprecated api version
+	Deprecated bool
+}
+
+// Info describes the API as a whole
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Document represents OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// PathItem maps lower case http methods to their operation
+type PathItem map[string]*Operation
+
+// Operation represents one method on a path
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+// Parameter represents path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody represents request body of an operation
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response represents response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the schemas referenced by operations
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme represents how requests authenticate
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	// In and Name locate an apiKey, like a cookie
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Build creates the document of routes, errors of every route are
+// described by problem
+func Build(info Info, routes []Route, problem interface{}) *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearer": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "token from /login, /auth/{provider}/callback or /oauth/token",
+				},
+				"session": {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        "session",
+					Description: "session cookie set by /login with session=true, unsafe requests echo the csrf cookie in X-CSRF-Token",
+				},
+			},
+		},
+	}
+	problemSchema := g.schema(problem)
+
+	for _, route := range routes {
+		path, params := convertPath(route.Path)
+		op := &Operation{
+			Summary:     route.Summary,
+			OperationID: operationID(route.Method, route.Path),
+			Parameters:  params,
+			Deprecated:  route.Deprecated,
+			Responses: map[string]Response{
+				"default": {
+					Description: "error",
+					Content:     map[string]MediaType{"application/problem+json": {Schema: problemSchema}},
+				},
+			},
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+		}
+		for _, q := range route.Query {
+			op.Parameters = append(op.Parameters, Parameter{Name: q, In: "query", Schema: &Schema{Type: "string"}})
+		}
+		if route.Auth {
+			scopes := []string{}
+			if route.Scope != "" {
+				scopes = append(scopes, route.Scope)
+			}
+			// sessions are first-party and carry every scope
+			op.Security = []map[string][]string{{"bearer": scopes}, {"session": {}}}
+		}
+		if route.Request != nil {
+			contentType := route.RequestType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{contentType: {Schema: g.schema(route.Request)}},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := Response{Description: http.StatusText(status)}
+		if route.Response != nil {
+			contentType := route.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			response.Content = map[string]MediaType{contentType: {Schema: g.schema(route.Response)}}
+		}
+		op.Responses[strconv.Itoa(status)] = response
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+// Missing returns the registered routes that have no documentation
+func Missing(registered gin.RoutesInfo, routes []Route) []string {
+	documented := map[string]bool{}
+	for _, route := range routes {
+		documented[route.Method+" "+route.Path] = true
+	}
+	missing := []string{}
+	for _, r := range registered {
+		if !documented[r.Method+" "+r.Path] {
+			missing = append(missing, r.Method+" "+r.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// convertPath turns gin parameters into OpenAPI ones
+func convertPath(path string) (string, []Parameter) {
+	params := []Parameter{}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			name := s[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a stable id like patchUsersUidPostsPid
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, s := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == ':' || r == '*' || r == '-' || r == '_' || r == '.'
+	}) {
+		id += strings.ToUpper(s[:1]) + s[1:]
+	}
+	return id
+}
@@ -0,0 +1,70 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Bind applies the PATCH request body to current and decodes the result
+// into obj. Only members listed in allowed may change and only the changed
+// members are validated.
+func Bind(c *gin.Context, current interface{}, allowed []string, obj interface{}) error {
+	contentType := c.ContentType()
+	if contentType != MergePatchType && contentType != JSONPatchType {
+		return apperror.New(apperror.CodeUnsupportedMediaType, "use "+MergePatchType+" or "+JSONPatchType)
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return apperror.Wrap(err, apperror.CodeBadRequest, "can't read request body")
+	}
+
+	fields, err := Fields(contentType, body)
+	if err != nil {
+		return apperror.Wrap(err, apperror.CodeBadRequest, "invalid patch document")
+	}
+	immutable := []apperror.FieldError{}
+	for _, f := range fields {
+		if !contains(allowed, f) {
+			immutable = append(immutable, validation.Field(f, "immutable", f+" can't be changed"))
+		}
+	}
+	if len(immutable) > 0 {
+		return apperror.Validation(immutable...)
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return apperror.Internal(err)
+	}
+	if contentType == MergePatchType {
+		doc, err = Merge(doc, body)
+	} else {
+		doc, err = Apply(doc, body)
+	}
+	if errors.Is(err, ErrInvalid) {
+		return apperror.Wrap(err, apperror.CodeBadRequest, "invalid patch document")
+	}
+	if err != nil {
+		return apperror.Internal(err)
+	}
+
+	if err := json.Unmarshal(doc, obj); err != nil {
+		return apperror.Wrap(err, apperror.CodeBadRequest, "patch produces invalid document")
+	}
+	return validation.Partial(obj, fields)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// patch media types
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrInvalid is returned for patch documents that can't be applied
+var ErrInvalid = errors.New("invalid patch document")
+
+// Merge applies RFC 7396 merge patch to the JSON object doc
+func Merge(doc, patch []byte) ([]byte, error) {
+	target := map[string]interface{}{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%w: merge patch must be an object", ErrInvalid)
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = merge(t[k], v)
+	}
+	return t
+}
+
+// Operation represents one RFC 6902 operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies RFC 6902 JSON patch to the JSON object doc. Resources are
+// flat, so only paths to top-level members are supported.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	ops, err := operations(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		name, err := member(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		_, exists := target[name]
+
+		switch op.Op {
+		case "add":
+			target[name] = op.Value
+		case "replace":
+			if !exists {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, op.Path)
+			}
+			target[name] = op.Value
+		case "remove":
+			if !exists {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, op.Path)
+			}
+			delete(target, name)
+		case "test":
+			if !exists || !equal(target[name], op.Value) {
+				return nil, fmt.Errorf("%w: test of %s failed", ErrInvalid, op.Path)
+			}
+		case "move", "copy":
+			from, err := member(op.From)
+			if err != nil {
+				return nil, err
+			}
+			value, ok := target[from]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s does not exist", ErrInvalid, op.From)
+			}
+			if op.Op == "move" {
+				delete(target, from)
+			}
+			target[name] = value
+		default:
+			return nil, fmt.Errorf("%w: unknown op %q", ErrInvalid, op.Op)
+		}
+	}
+	return json.Marshal(target)
+}
+
+// Fields returns the top-level members a patch of content type changes
+func Fields(contentType string, patch []byte) ([]string, error) {
+	switch contentType {
+	case MergePatchType:
+		p := map[string]json.RawMessage{}
+		if err := json.Unmarshal(patch, &p); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		fields := make([]string, 0, len(p))
+		for k := range p {
+			fields = append(fields, k)
+		}
+		return fields, nil
+	case JSONPatchType:
+		ops, err := operations(patch)
+		if err != nil {
+			return nil, err
+		}
+		fields := []string{}
+		for _, op := range ops {
+			if op.Op == "test" {
+				continue
+			}
+			name, err := member(op.Path)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, name)
+			if op.Op == "move" {
+				from, err := member(op.From)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, from)
+			}
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported content type %q", ErrInvalid, contentType)
+}
+
+func operations(patch []byte) ([]Operation, error) {
+	ops := []Operation{}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return ops, nil
+}
+
+// member decodes a JSON pointer to a top-level member
+func member(pointer string) (string, error) {
+	if !strings.HasPrefix(pointer, "/") || strings.Contains(pointer[1:], "/") {
+		return "", fmt.Errorf("%w: unsupported path %q", ErrInvalid, pointer)
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), nil
+}
+
+func equal(a, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
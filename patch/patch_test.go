@@ -0,0 +1,126 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/patch"
+	"github.com/gin-gonic/gin"
+)
+
+type profile struct {
+	Username string `json:"username" binding:"required,min=3"`
+	Name     string `json:"name" binding:"max=10"`
+	Likes    int    `json:"likes" binding:"min=0"`
+}
+
+func apply(contentType, body string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.PATCH("/profile", func(c *gin.Context) {
+		current := profile{Username: "blink", Name: "Blink", Likes: 3}
+		req := profile{}
+		if err := patch.Bind(c, current, []string{"name", "likes"}, &req); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	})
+
+	req := httptest.NewRequest(http.MethodPatch, "/profile", strings.NewReader(body))
+	req.Header.Add("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMerge(t *testing.T) {
+	given := `{"b":null,"c":{"d":1}}`
+	get, err := patch.Merge([]byte(`{"a":1,"b":2,"c":{"e":2}}`), []byte(given))
+	if err != nil {
+		t.Error("given", given, "want no error but get", err)
+		return
+	}
+
+	want := `{"a":1,"c":{"d":1,"e":2}}`
+	if string(get) != want {
+		t.Error("given", given, "want", want, "but get", string(get))
+	}
+}
+
+func TestApply(t *testing.T) {
+	given := `[{"op":"test","path":"/a","value":1},{"op":"replace","path":"/a","value":5},{"op":"remove","path":"/b"}]`
+	get, err := patch.Apply([]byte(`{"a":1,"b":2}`), []byte(given))
+	if err != nil {
+		t.Error("given", given, "want no error but get", err)
+		return
+	}
+
+	want := `{"a":5}`
+	if string(get) != want {
+		t.Error("given", given, "want", want, "but get", string(get))
+	}
+
+	given = `[{"op":"test","path":"/a","value":2}]`
+	if _, err := patch.Apply([]byte(`{"a":1}`), []byte(given)); err == nil {
+		t.Error("given", given, "want failed test error but get none")
+	}
+}
+
+func TestBindClearsField(t *testing.T) {
+	given := `{"name":null}`
+	rec := apply(patch.MergePatchType, given)
+
+	if rec.Code != http.StatusOK {
+		t.Error("given", given, "status code is not ok", rec.Code, rec.Body.String())
+		return
+	}
+
+	get := profile{}
+	json.Unmarshal(rec.Body.Bytes(), &get)
+	want := profile{Username: "blink", Name: "", Likes: 3}
+	if get != want {
+		t.Error("given", given, "want", want, "but get", get)
+	}
+}
+
+func TestBindJSONPatch(t *testing.T) {
+	given := `[{"op":"replace","path":"/likes","value":0}]`
+	rec := apply(patch.JSONPatchType, given)
+
+	if rec.Code != http.StatusOK {
+		t.Error("given", given, "status code is not ok", rec.Code, rec.Body.String())
+		return
+	}
+
+	get := profile{}
+	json.Unmarshal(rec.Body.Bytes(), &get)
+	if get.Likes != 0 || get.Name != "Blink" {
+		t.Error("given", given, "want likes 0 and name unchanged but get", get)
+	}
+}
+
+func TestBindRejected(t *testing.T) {
+	tests := []struct {
+		contentType string
+		given       string
+		want        int
+	}{
+		{patch.MergePatchType, `{"username":"other"}`, http.StatusUnprocessableEntity},
+		{patch.MergePatchType, `{"name":"much too long name"}`, http.StatusUnprocessableEntity},
+		{patch.MergePatchType, `[1,2]`, http.StatusBadRequest},
+		{patch.JSONPatchType, `[{"op":"replace","path":"/missing","value":1}]`, http.StatusUnprocessableEntity},
+		{"application/json", `{"name":"x"}`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		rec := apply(test.contentType, test.given)
+		if rec.Code != test.want {
+			t.Error("given", test.contentType, test.given, "want status", test.want, "but get", rec.Code)
+		}
+	}
+}
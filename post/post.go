@@ -1,32 +1,52 @@
 package post
 
 import (
-	"database/sql"
-	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/etag"
+	"example.com/social-gin/patch"
 	"example.com/social-gin/user"
+	"example.com/social-gin/validation"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 // Post represents user post
 type Post struct {
-	ID        uint         `gorm:"primarykey" json:"id"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"update_at"`
-	DeletedAt sql.NullTime `gorm:"index" json:"-"`
-	UserID    int          `json:"user_id"`
-	User      user.User    `json:"-"`
-	Content   string       `json:"content"`
-	Likes     int          `json:"likes"`
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"update_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	UserID    int            `json:"user_id"`
+	User      user.User      `json:"-"`
+	Content   string         `json:"content"`
+	Likes     int            `json:"likes"`
+	// Version increases on every write, it's the ETag of the post
+	Version uint `gorm:"not null;default:1" json:"-"`
 }
 
+// PostRequest represents body of add, replace and patch post request
+type PostRequest struct {
+	Content string `json:"content" form:"content" binding:"required,max=2000"`
+	Likes   int    `json:"likes" form:"likes" binding:"min=0"`
+}
+
+// patchable lists the post fields a patch may change
+var patchable = []string{"content", "likes"}
+
 // Handler handles user requests
 type Handler struct {
 	DB *gorm.DB
+	// RestoreGrace is how long a deleted post can be restored, zero means forever
+	RestoreGrace time.Duration
+	// RequireIfMatch rejects writes without If-Match header
+	RequireIfMatch bool
+	// Audit records writes, nothing when nil
+	Audit *audit.Trail
 }
 
 // AddPost handle add post request
@@ -36,153 +56,173 @@ func (h *Handler) AddPost(c *gin.Context) {
 	loginUid := c.MustGet("uid")
 
 	if loginUid != c.Param("uid") {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "unauthorized user",
-		})
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
 		return
 	}
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
 		return
 	}
-	post := Post{}
-
-	if err := c.Bind(&post); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	req := PostRequest{}
+	if err := validation.Bind(c, &req); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	post.UserID = uid
+	post := Post{
+		UserID:  uid,
+		Content: req.Content,
+		Likes:   req.Likes,
+		Version: 1,
+	}
 
-	if result := h.DB.Create(&post); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := h.db(c).Create(&post); result.Error != nil {
+		apperror.Abort(c, result.Error)
 		return
 	}
-	c.JSON(http.StatusOK, post)
+	h.Audit.Record(c, audit.Event{Action: "post.create", Target: target(post), After: post})
+	etag.Set(c, post.Version)
+	c.JSON(http.StatusOK, view(c, post))
 }
 
 // ListPost handle list post request
 func (h *Handler) ListPost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
 		return
 	}
 	posts := []Post{}
-	if result := h.DB.Where("user_id = ?", uid).Find(&posts); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := h.db(c).Where("user_id = ?", uid).Find(&posts); result.Error != nil {
+		apperror.Abort(c, result.Error)
 		return
 	}
-	c.JSON(http.StatusOK, posts)
+	c.JSON(http.StatusOK, viewList(c, posts))
 }
 
 // GetPost handle get post request
 func (h *Handler) GetPost(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
 		return
 	}
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid post id"))
 		return
 	}
 	post := Post{}
-	if result := h.DB.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
-		return
-	}
-	c.JSON(http.StatusOK, post)
+	if result := h.db(c).Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	if etag.NotModified(c, post.Version) {
+		return
+	}
+	c.JSON(http.StatusOK, view(c, post))
 }
 
-// UpdatePost handle update post request
+// UpdatePost handle replace post request, every field is overwritten
 func (h *Handler) UpdatePost(c *gin.Context) {
+	post, ok := h.ownPost(c)
+	if !ok {
+		return
+	}
+
+	req := PostRequest{}
+	if err := validation.Bind(c, &req); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	h.save(c, post, req)
+}
+
+// PatchPost handle patch post request with merge patch or json patch body
+func (h *Handler) PatchPost(c *gin.Context) {
+	post, ok := h.ownPost(c)
+	if !ok {
+		return
+	}
+
+	current := PostRequest{
+		Content: post.Content,
+		Likes:   post.Likes,
+	}
+	req := PostRequest{}
+	if err := patch.Bind(c, current, patchable, &req); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	h.save(c, post, req)
+}
+
+// target names post in audit entries
+func target(post Post) string {
+	return "users/" + strconv.Itoa(post.UserID) + "/posts/" + strconv.Itoa(int(post.ID))
+}
+
+// db returns the database bound to the request context so queries join
+// the trace of the request
+func (h *Handler) db(c *gin.Context) *gorm.DB {
+	return h.DB.WithContext(c.Request.Context())
+}
+
+// ownPost loads the post of the uid and pid params, uid must be the login user
+func (h *Handler) ownPost(c *gin.Context) (*Post, bool) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 
 	loginUid := c.MustGet("uid")
 
 	if loginUid != c.Param("uid") {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "unauthorized user",
-		})
-		return
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
+		return nil, false
 	}
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
+		return nil, false
 	}
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+		apperror.Abort(c, apperror.BadRequest("invalid post id"))
+		return nil, false
 	}
-	post := Post{}
-	if result := h.DB.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
-		return
+	post := &Post{}
+	if result := h.db(c).Where("user_id = ? and id = ?", uid, pid).First(post); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return nil, false
 	}
-
-	updatePost := Post{}
-	if err := c.Bind(&updatePost); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+	if err := etag.Check(c, post.Version, h.RequireIfMatch); err != nil {
+		apperror.Abort(c, err)
+		return nil, false
 	}
+	return post, true
+}
 
-	// update fields
-	if post.Content != "" {
-		post.Content = updatePost.Content
-	}
-	if post.Likes != 0 {
-		post.Likes = updatePost.Likes
-	}
+// save stores req as the new state of post
+func (h *Handler) save(c *gin.Context, post *Post, req PostRequest) {
+	before := *post
+	version := post.Version
+	post.Content = req.Content
+	post.Likes = req.Likes
+	post.Version++
 
-	if result := h.DB.Save(&post); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	// only write when nobody else has written since the post was loaded
+	result := h.db(c).Model(post).Where("version = ?", version).
+		Select("content", "likes", "version").Updates(post)
+	if result.Error != nil {
+		apperror.Abort(c, result.Error)
 		return
 	}
-
-	c.JSON(http.StatusOK, post)
+	if result.RowsAffected == 0 {
+		apperror.Abort(c, etag.Modified())
+		return
+	}
+	h.Audit.Record(c, audit.Event{Action: "post.update", Target: target(*post), Before: before, After: *post})
+	etag.Set(c, post.Version)
+	c.JSON(http.StatusOK, view(c, *post))
 }
 
 // DeletePost handle delete post request
@@ -192,44 +232,46 @@ func (h *Handler) DeletePost(c *gin.Context) {
 	loginUid := c.MustGet("uid")
 
 	if loginUid != c.Param("uid") {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "unauthorized user",
-		})
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
 		return
 	}
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
 		return
 	}
 	pid, err := strconv.Atoi(c.Param("pid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid post id"))
 		return
 	}
+	// permanent delete also drops posts already in the trash
+	db := h.db(c)
+	action := "post.delete"
+	if c.Query("permanent") == "true" {
+		db = db.Unscoped()
+		action = "post.purge"
+	}
+
 	post := Post{}
-	if result := h.DB.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := db.Where("user_id = ? and id = ?", uid, pid).First(&post); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	if err := etag.Check(c, post.Version, h.RequireIfMatch); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result := h.DB.Delete(&post); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	result := db.Where("version = ?", post.Version).Delete(&post)
+	if result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		apperror.Abort(c, etag.Modified())
 		return
 	}
-	c.JSON(http.StatusOK, post)
+	h.Audit.Record(c, audit.Event{Action: action, Target: target(post), Before: post})
+	c.JSON(http.StatusOK, view(c, post))
 }
@@ -0,0 +1,102 @@
+package post
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListDeletedPost handle list deleted post request
+func (h *Handler) ListDeletedPost(c *gin.Context) {
+	uid, err := strconv.Atoi(c.Param("uid"))
+
+	loginUid := c.MustGet("uid")
+
+	if loginUid != c.Param("uid") {
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
+		return
+	}
+
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
+		return
+	}
+
+	query := h.db(c).Unscoped().Where("user_id = ? and deleted_at is not null", uid)
+	if h.RestoreGrace > 0 {
+		query = query.Where("deleted_at > ?", time.Now().Add(-h.RestoreGrace))
+	}
+
+	posts := []Post{}
+	if result := query.Find(&posts); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, viewList(c, posts))
+}
+
+// RestorePost handle restore deleted post request
+func (h *Handler) RestorePost(c *gin.Context) {
+	uid, err := strconv.Atoi(c.Param("uid"))
+
+	loginUid := c.MustGet("uid")
+
+	if loginUid != c.Param("uid") {
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
+		return
+	}
+
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
+		return
+	}
+	pid, err := strconv.Atoi(c.Param("pid"))
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest("invalid post id"))
+		return
+	}
+	post := Post{}
+	if result := h.db(c).Unscoped().Where("user_id = ? and id = ? and deleted_at is not null", uid, pid).First(&post); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+
+	if h.RestoreGrace > 0 && time.Since(post.DeletedAt.Time) > h.RestoreGrace {
+		apperror.Abort(c, apperror.Gone("post was deleted too long ago to be restored"))
+		return
+	}
+
+	if result := h.db(c).Unscoped().Model(&post).Update("deleted_at", nil); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	post.DeletedAt = gorm.DeletedAt{}
+	h.Audit.Record(c, audit.Event{Action: "post.restore", Target: target(post)})
+	c.JSON(http.StatusOK, view(c, post))
+}
+
+// Purge hard-deletes posts soft-deleted before the given time
+func (h *Handler) Purge(before time.Time) (int64, error) {
+	result := h.DB.Unscoped().Where("deleted_at < ?", before).Delete(&Post{})
+	return result.RowsAffected, result.Error
+}
+
+// SoftDeleteOwned soft-deletes the posts of a deleted user
+func (h *Handler) SoftDeleteOwned(tx *gorm.DB, uid uint, at time.Time) error {
+	return tx.Model(&Post{}).Where("user_id = ? and deleted_at is null", uid).Update("deleted_at", at).Error
+}
+
+// RestoreOwned restores the posts deleted together with their user
+func (h *Handler) RestoreOwned(tx *gorm.DB, uid uint, at time.Time) error {
+	return tx.Unscoped().Model(&Post{}).Where("user_id = ? and deleted_at = ?", uid, at).Update("deleted_at", nil).Error
+}
+
+// PurgeOwned hard-deletes every post of a user
+func (h *Handler) PurgeOwned(tx *gorm.DB, uid uint) error {
+	return tx.Unscoped().Where("user_id = ?", uid).Delete(&Post{}).Error
+}
@@ -0,0 +1,49 @@
+package post
+
+import (
+	"time"
+
+	"example.com/social-gin/apiversion"
+	"github.com/gin-gonic/gin"
+)
+
+// PostV2 represents user post in api v2, which fixes the updated_at name
+type PostV2 struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    int       `json:"user_id"`
+	Content   string    `json:"content"`
+	Likes     int       `json:"likes"`
+}
+
+// NewPostV2 converts post to its api v2 representation
+func NewPostV2(p Post) PostV2 {
+	return PostV2{
+		ID:        p.ID,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+		UserID:    p.UserID,
+		Content:   p.Content,
+		Likes:     p.Likes,
+	}
+}
+
+// view returns post in the representation of the request api version
+func view(c *gin.Context, p Post) interface{} {
+	if apiversion.Get(c) >= 2 {
+		return NewPostV2(p)
+	}
+	return p
+}
+
+func viewList(c *gin.Context, posts []Post) interface{} {
+	if apiversion.Get(c) >= 2 {
+		v := make([]PostV2, 0, len(posts))
+		for _, p := range posts {
+			v = append(v, NewPostV2(p))
+		}
+		return v
+	}
+	return posts
+}
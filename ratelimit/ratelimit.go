@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Result represents the outcome of a rate limit check
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Store counts requests of a key within a sliding window
+type Store interface {
+	Allow(key string, limit int, window time.Duration) (Result, error)
+}
+
+// KeyFunc extracts the key a request is limited by
+type KeyFunc func(c *gin.Context) string
+
+// ByIP limits requests by client ip
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser limits requests by the user id set by user.Handler.Authorize,
+// falling back to client ip for anonymous requests
+func ByUser(c *gin.Context) string {
+	if uid := c.GetString("uid"); uid != "" {
+		return "uid:" + uid
+	}
+	return ByIP(c)
+}
+
+// ByAPIKey limits requests by the given header, falling back to client ip
+func ByAPIKey(header string) KeyFunc {
+	return func(c *gin.Context) string {
+		if key := c.GetHeader(header); key != "" {
+			return "key:" + key
+		}
+		return ByIP(c)
+	}
+}
+
+// Config represents a rate limit rule
+type Config struct {
+	// Name scopes the counters so different rules don't share them
+	Name   string
+	Limit  int
+	Window time.Duration
+	// GetRule, when set, is called on every request for the limit and
+	// window instead, so they can change while serving
+	GetRule func() (limit int, window time.Duration)
+	Key     KeyFunc
+	Store   Store
+}
+
+// Middleware return rate limit middleware function
+func Middleware(cfg Config) gin.HandlerFunc {
+	if cfg.Key == nil {
+		cfg.Key = ByIP
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+
+	return func(c *gin.Context) {
+		key := cfg.Name + ":" + cfg.Key(c)
+		limit, window := cfg.Limit, cfg.Window
+		if cfg.GetRule != nil {
+			limit, window = cfg.GetRule()
+		}
+
+		result, err := cfg.Store.Allow(key, limit, window)
+		if err != nil {
+			// don't reject traffic because the limiter is unavailable
+			logger.Extract(c).Warn("rate limit check failed", zap.String("key", key), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(result.Reset.Unix(), 10))
+
+		if !result.Allowed {
+			retryAfter := int(time.Until(result.Reset).Seconds() + 0.5)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			apperror.Abort(c, apperror.New(apperror.CodeTooManyRequests, "rate limit exceeded"))
+			return
+		}
+
+		c.Next()
+	}
+}
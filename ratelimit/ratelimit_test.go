@@ -0,0 +1,154 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+func setupRouter(cfg ratelimit.Config) *gin.Engine {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.Use(ratelimit.Middleware(cfg))
+	r.GET("/hello", func(c *gin.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+	return r
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+
+	for i := 0; i < 3; i++ {
+		result, _ := s.Allow("a", 3, time.Minute)
+		if !result.Allowed {
+			t.Error("given request", i+1, "of 3 want allowed but get rejected")
+		}
+		if result.Remaining != 2-i {
+			t.Error("given request", i+1, "want remaining", 2-i, "but get", result.Remaining)
+		}
+	}
+
+	if result, _ := s.Allow("a", 3, time.Minute); result.Allowed {
+		t.Error("given request 4 of 3 want rejected but get allowed")
+	}
+
+	if result, _ := s.Allow("b", 3, time.Minute); !result.Allowed {
+		t.Error("given other key want allowed but get rejected")
+	}
+}
+
+func TestMemoryStoreWindowSlides(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+
+	s.Allow("a", 1, 50*time.Millisecond)
+	if result, _ := s.Allow("a", 1, 50*time.Millisecond); result.Allowed {
+		t.Error("want rejected within window but get allowed")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if result, _ := s.Allow("a", 1, 50*time.Millisecond); !result.Allowed {
+		t.Error("want allowed after window but get rejected")
+	}
+}
+
+func TestMemoryStoreSweepKeepsLongerWindows(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+
+	s.Allow("login", 1, time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	// enough calls under a short window to sweep
+	for i := 0; i < 1000; i++ {
+		s.Allow("hello", 1000, 10*time.Millisecond)
+	}
+	if result, _ := s.Allow("login", 1, time.Hour); result.Allowed {
+		t.Error("given sweep under a shorter window want hour window kept but get allowed")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := setupRouter(ratelimit.Config{
+		Name:   "test",
+		Limit:  2,
+		Window: time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Error("status code is not ok", rec.Code)
+			return
+		}
+		if rec.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Error("want X-RateLimit-Limit 2 but get", rec.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Error("want status", http.StatusTooManyRequests, "but get", rec.Code)
+	}
+	if rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Error("want X-RateLimit-Remaining 0 but get", rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("want Retry-After header but get none")
+	}
+}
+
+func TestMiddlewareGetRule(t *testing.T) {
+	limit := 1
+	r := setupRouter(ratelimit.Config{
+		Name:    "test",
+		GetRule: func() (int, time.Duration) { return limit, time.Minute },
+	})
+
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+		return rec.Code
+	}
+	serve()
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Error("given limit 1 want status", http.StatusTooManyRequests, "but get", code)
+	}
+
+	limit = 5
+	if code := serve(); code != http.StatusOK {
+		t.Error("given limit raised to 5 want status ok but get", code)
+	}
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Allow(key string, limit int, window time.Duration) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestFallbackStore(t *testing.T) {
+	s := &ratelimit.FallbackStore{
+		Primary:   brokenStore{},
+		Secondary: ratelimit.NewMemoryStore(),
+	}
+
+	s.Allow("a", 1, time.Minute)
+	result, err := s.Allow("a", 1, time.Minute)
+	if err != nil {
+		t.Error("want no error but get", err)
+	}
+	if result.Allowed {
+		t.Error("want rejected by fallback store but get allowed")
+	}
+}
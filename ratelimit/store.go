@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps sliding windows in process memory, suitable for a single
+// instance or as a fallback when redis is unavailable
+type MemoryStore struct {
+	mu      sync.Mutex
+	windows map[string]*memoryWindow
+	calls   int
+}
+
+// memoryWindow is the hits of a key within the window of its rule
+type memoryWindow struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		windows: map[string]*memoryWindow{},
+	}
+}
+
+// Allow records a request for key if it is within limit
+func (s *MemoryStore) Allow(key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop idle keys from time to time so the map doesn't grow forever
+	s.calls++
+	if s.calls%1000 == 0 {
+		s.sweep(now)
+	}
+
+	w, ok := s.windows[key]
+	if !ok {
+		w = &memoryWindow{}
+		s.windows[key] = w
+	}
+	w.window = window
+	hits := prune(w.hits, now.Add(-window))
+
+	result := Result{Limit: limit}
+	if len(hits) < limit {
+		hits = append(hits, now)
+		result.Allowed = true
+	}
+	w.hits = hits
+
+	result.Remaining = limit - len(hits)
+	result.Reset = now.Add(window)
+	if len(hits) > 0 {
+		result.Reset = hits[0].Add(window)
+	}
+	return result, nil
+}
+
+// sweep drops keys without hits in their own window, rules with a short
+// window don't cut the history of the longer ones
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, w := range s.windows {
+		if len(w.hits) == 0 || w.hits[len(w.hits)-1].Before(now.Add(-w.window)) {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// prune removes hits older than since, hits are kept in ascending order
+func prune(hits []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(since) {
+		i++
+	}
+	return hits[i:]
+}
+
+// slidingWindow atomically trims the window, counts it and records the hit
+// when it fits, returning {allowed, count, reset in ms}
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', key, window)
+
+local reset = now + window
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window
+end
+return {allowed, count, reset}
+`)
+
+// RedisStore shares sliding windows between instances through redis
+type RedisStore struct {
+	Client *redis.Client
+	Prefix string
+}
+
+// Allow records a request for key if it is within limit
+func (s *RedisStore) Allow(key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	ms := int64(window / time.Millisecond)
+
+	reply, err := slidingWindow.Run(s.Client, []string{s.Prefix + key}, now, ms, limit, uuid.New().String()).Result()
+	if err != nil {
+		return Result{}, err
+	}
+
+	values := reply.([]interface{})
+	count := int(values[1].(int64))
+	return Result{
+		Allowed:   values[0].(int64) == 1,
+		Limit:     limit,
+		Remaining: limit - count,
+		Reset:     time.Unix(0, values[2].(int64)*int64(time.Millisecond)),
+	}, nil
+}
+
+// FallbackStore uses Secondary whenever Primary fails
+type FallbackStore struct {
+	Primary   Store
+	Secondary Store
+}
+
+// Allow records a request for key if it is within limit
+func (s *FallbackStore) Allow(key string, limit int, window time.Duration) (Result, error) {
+	result, err := s.Primary.Allow(key, limit, window)
+	if err != nil {
+		return s.Secondary.Allow(key, limit, window)
+	}
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package requestid
+
+import (
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transport sends the request id of the request context to the called
+// service, unless the request already has one
+type Transport struct {
+	// Base is the transport doing the request, http.DefaultTransport when nil
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return base.RoundTrip(req)
+	}
+	// a round tripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return base.RoundTrip(req)
+}
+
+// InstrumentGORM prefixes every statement run with a request context with a
+// comment holding the request id, so slow query logs lead to the request
+func InstrumentGORM(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("requestid:create", comment),
+		cb.Query().Before("gorm:query").Register("requestid:query", comment),
+		cb.Update().Before("gorm:update").Register("requestid:update", comment),
+		cb.Delete().Before("gorm:delete").Register("requestid:delete", comment),
+		cb.Row().Before("gorm:row").Register("requestid:row", comment),
+		cb.Raw().Before("gorm:raw").Register("requestid:raw", comment),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statements are the clauses a statement may start with, the comment goes
+// before whichever of them gets built
+var statements = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+
+func comment(db *gorm.DB) {
+	id := FromContext(db.Statement.Context)
+	// ids are validated, but the context may be set by anyone
+	if !Valid(id) {
+		return
+	}
+	c := "/* request_id=" + id + " */"
+
+	// raw sql is already written
+	if db.Statement.SQL.Len() > 0 {
+		sql := db.Statement.SQL.String()
+		db.Statement.SQL.Reset()
+		db.Statement.SQL.WriteString(c + " " + sql)
+		return
+	}
+	for _, name := range statements {
+		cl := db.Statement.Clauses[name]
+		cl.BeforeExpression = clause.Expr{SQL: c}
+		db.Statement.Clauses[name] = cl
+	}
+}
@@ -0,0 +1,63 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the request id in requests and responses
+const Header = "X-Request-ID"
+
+// MaxLength is the longest request id accepted from a client
+const MaxLength = 64
+
+type contextKey struct{}
+
+// New creates a time ordered id, so ids sort in the order requests arrived
+func New() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.New().String()
+	}
+	return id.String()
+}
+
+// Valid reports id is safe to log, echo and put in sql comments: 1 to
+// MaxLength letters, digits, dots, dashes, underscores or colons
+func Valid(id string) bool {
+	if len(id) == 0 || len(id) > MaxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '-', r == '_', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve returns the id sent by the client when it's valid, or a new one
+func Resolve(id string) string {
+	if Valid(id) {
+		return id
+	}
+	return New()
+}
+
+// NewContext returns ctx carrying id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id in ctx, empty if there's none
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,110 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/logger"
+	"example.com/social-gin/requestid"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+func TestResolve(t *testing.T) {
+	for _, id := range []string{"abc-123", "0190b7f2-7c3e-7a6b-9d2f-3c4e5f6a7b8c", "svc:req_1.2"} {
+		if got := requestid.Resolve(id); got != id {
+			t.Error("given", id, "want it kept but get", got)
+		}
+	}
+	for _, id := range []string{"", "a b", "x */ drop table users --", strings.Repeat("a", requestid.MaxLength+1)} {
+		got := requestid.Resolve(id)
+		if got == id || !requestid.Valid(got) {
+			t.Error("given", id, "want a new valid id but get", got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(logger.Middleware(zap.NewNop()))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, requestid.FromContext(c.Request.Context()))
+	})
+
+	for _, sent := range []string{"", "client-id-1", "bad id"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if sent != "" {
+			req.Header.Set(requestid.Header, sent)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(requestid.Header)
+		if !requestid.Valid(got) {
+			t.Error("given", sent, "want valid id echoed but get", got)
+		}
+		if sent == "client-id-1" && got != sent {
+			t.Error("given", sent, "want id kept but get", got)
+		}
+		if rec.Body.String() != got {
+			t.Error("given", sent, "want context id", got, "but get", rec.Body.String())
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(requestid.Header)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &requestid.Transport{}}
+	req, _ := http.NewRequestWithContext(requestid.NewContext(context.Background(), "abc"), http.MethodGet, srv.URL, nil)
+	if _, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if got != "abc" {
+		t.Error("want id abc sent but get", got)
+	}
+	if req.Header.Get(requestid.Header) != "" {
+		t.Error("want caller's request untouched but get", req.Header)
+	}
+}
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+func TestInstrumentGORM(t *testing.T) {
+	db, err := gorm.Open(sqlserver.Open("sqlserver://sa:x@127.0.0.1:1?database=x"), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := requestid.InstrumentGORM(db); err != nil {
+		t.Fatal(err)
+	}
+	tx := db.WithContext(requestid.NewContext(context.Background(), "abc"))
+
+	for name, stmt := range map[string]*gorm.Statement{
+		"query":  tx.Where("name = ?", "a").Find(&[]item{}).Statement,
+		"create": tx.Create(&item{Name: "a"}).Statement,
+		"update": tx.Model(&item{ID: 1}).Update("name", "b").Statement,
+		"delete": tx.Delete(&item{ID: 1}).Statement,
+		"raw":    tx.Raw("select 1").Find(&[]item{}).Statement,
+	} {
+		if sql := stmt.SQL.String(); !strings.HasPrefix(sql, "/* request_id=abc */ ") {
+			t.Error("given", name, "want sql commented with request id but get", sql)
+		}
+	}
+
+	if sql := db.Find(&[]item{}).Statement.SQL.String(); strings.Contains(sql, "request_id") {
+		t.Error("want no comment without request id but get", sql)
+	}
+}
@@ -0,0 +1,123 @@
+// Package router registers the routes of the api
+package router
+
+import (
+	"example.com/social-gin/admin"
+	"example.com/social-gin/apiversion"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/docs"
+	"example.com/social-gin/export"
+	"example.com/social-gin/health"
+	"example.com/social-gin/oauth"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/openapi"
+	"example.com/social-gin/post"
+	"example.com/social-gin/user"
+	"github.com/gin-gonic/gin"
+)
+
+// Router holds what the routes are served by
+type Router struct {
+	User   *user.Handler
+	Post   *post.Handler
+	OIDC   *oidc.Handler
+	OAuth  *oauth.Handler
+	Export *export.Handler
+	Health *health.Handler
+	Admin  *admin.Handler
+	Audit  *audit.Trail
+
+	// Metrics serves the metrics to callers let through by Internal
+	Metrics  gin.HandlerFunc
+	Internal gin.HandlerFunc
+	// Limit applies to every route but the probes, UserLimit per
+	// authenticated user and LoginLimit per ip to routes taking a password
+	Limit      gin.HandlerFunc
+	UserLimit  gin.HandlerFunc
+	LoginLimit gin.HandlerFunc
+	// Idempotent replays retried creates sent with the same Idempotency-Key
+	Idempotent gin.HandlerFunc
+
+	// Admins are the ids of the admins
+	Admins []string
+	// V1 is the deprecation announced on the v1 routes
+	V1 apiversion.Deprecation
+}
+
+// Register adds the routes to r, docs.Routes must list every one of them
+func (rt *Router) Register(r *gin.Engine) {
+	// probes come before rate limits so they are never throttled
+	r.GET("/healthz", rt.Health.Live)
+	r.GET("/readyz", rt.Health.Ready)
+	r.GET("/metrics", rt.Internal, rt.Metrics)
+
+	r.Use(rt.Limit)
+
+	g := r.Group("", rt.User.Authorize, rt.UserLimit)
+
+	r.GET("/hello", rt.User.Hello)
+
+	r.POST("/login", rt.LoginLimit, rt.User.LogIn)
+	r.POST("/logout", rt.User.LogOut)
+	r.GET("/auth/:provider/login", rt.OIDC.Login)
+	r.GET("/auth/:provider/callback", rt.OIDC.Callback)
+
+	// resources are served per api version, the unprefixed routes are v1
+	// kept working for clients that haven't moved to a prefix yet
+	versions := []*gin.RouterGroup{
+		r.Group("", apiversion.Use(1), apiversion.Deprecated("", rt.V1)),
+		r.Group("/v1", apiversion.Use(1), apiversion.Deprecated("/v1", rt.V1)),
+		r.Group("/v2", apiversion.Use(2)),
+	}
+	for _, api := range versions {
+		a := api.Group("", rt.User.Authorize, rt.UserLimit)
+
+		api.GET("/users", rt.User.ListUser)
+		api.GET("/users/:uid", rt.User.GetUser)
+		api.POST("/users", rt.Idempotent, rt.User.AddUser)
+		a.PUT("/users/:uid", user.RequireScope("users:write"), rt.User.UpdateUser)
+		a.PATCH("/users/:uid", user.RequireScope("users:write"), rt.User.PatchUser)
+		a.DELETE("/users/:uid", user.RequireScope("users:write"), rt.User.DeleteUser)
+
+		api.POST("/users/:uid/restore", rt.LoginLimit, rt.User.RestoreUser)
+
+		api.GET("/users/:uid/posts", rt.Post.ListPost)
+		api.GET("/users/:uid/posts/:pid", rt.Post.GetPost)
+		a.POST("/users/:uid/posts", user.RequireScope("posts:write"), rt.Idempotent, rt.Post.AddPost)
+		a.PUT("/users/:uid/posts/:pid", user.RequireScope("posts:write"), rt.Post.UpdatePost)
+		a.PATCH("/users/:uid/posts/:pid", user.RequireScope("posts:write"), rt.Post.PatchPost)
+		a.DELETE("/users/:uid/posts/:pid", user.RequireScope("posts:write"), rt.Post.DeletePost)
+		a.GET("/users/:uid/deleted-posts", user.RequireScope("posts:write"), rt.Post.ListDeletedPost)
+		a.POST("/users/:uid/posts/:pid/restore", user.RequireScope("posts:write"), rt.Post.RestorePost)
+
+		a.POST("/users/:uid/export", user.RequireFirstParty, rt.Idempotent, rt.Export.RequestExport)
+		a.GET("/users/:uid/exports/:eid", user.RequireFirstParty, rt.Export.GetExport)
+	}
+
+	// oauth2 authorization server for third-party clients
+	r.POST("/oauth/token", rt.OAuth.Token)
+	o := g.Group("/oauth", user.RequireFirstParty)
+	o.POST("/clients", rt.OAuth.RegisterClient)
+	o.GET("/authorize", rt.OAuth.Authorize)
+	o.POST("/authorize", rt.OAuth.Consent)
+	o.GET("/consents", rt.OAuth.ListConsent)
+	o.DELETE("/consents/:cid", rt.OAuth.RevokeConsent)
+
+	r.GET("/exports/:eid/download", rt.Export.Download)
+
+	// admin only, listed by user id in admin.users
+	ad := g.Group("/admin", user.RequireFirstParty, admin.Require(rt.Admins))
+	ad.GET("/log/level", rt.Admin.GetLogLevel)
+	ad.PUT("/log/level", rt.Admin.SetLogLevel)
+	ad.GET("/audit", rt.Audit.ListEntry)
+	ad.GET("/audit/verify", rt.Audit.Verify)
+
+	// authenticated group
+
+	g.GET("/tables", user.RequireFirstParty, rt.User.ListTable)
+
+	// api description
+	r.GET("/openapi.json", openapi.Spec(docs.Document()))
+	r.GET("/docs", openapi.UI(docs.Info.Title, "/openapi.json", "/docs/assets"))
+	r.GET("/docs/assets/*file", openapi.Assets)
+}
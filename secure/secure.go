@@ -0,0 +1,61 @@
+package secure
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPolicy lets a json response load nothing and be framed nowhere,
+// html pages like the docs set their own
+const DefaultPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// Config represents the security headers sent with every response
+type Config struct {
+	// HSTS is how long browsers only use https, sent on https requests
+	// only, off when zero
+	HSTS                  time.Duration `mapstructure:"hsts" validate:"gte=0"`
+	HSTSIncludeSubdomains bool          `mapstructure:"hsts_include_subdomains"`
+	// ContentSecurityPolicy is DefaultPolicy when empty
+	ContentSecurityPolicy string `mapstructure:"content_security_policy"`
+	// FrameOptions is DENY when empty
+	FrameOptions string `mapstructure:"frame_options" validate:"omitempty,oneof=DENY SAMEORIGIN"`
+	// ReferrerPolicy is no-referrer when empty
+	ReferrerPolicy string `mapstructure:"referrer_policy"`
+}
+
+// Middleware return security headers middleware function. Handlers may
+// replace the headers, like a page needing a looser policy.
+func Middleware(cfg Config) gin.HandlerFunc {
+	policy := cfg.ContentSecurityPolicy
+	if policy == "" {
+		policy = DefaultPolicy
+	}
+	frame := cfg.FrameOptions
+	if frame == "" {
+		frame = "DENY"
+	}
+	referrer := cfg.ReferrerPolicy
+	if referrer == "" {
+		referrer = "no-referrer"
+	}
+	hsts := "max-age=" + strconv.Itoa(int(cfg.HSTS.Seconds()))
+	if cfg.HSTSIncludeSubdomains {
+		hsts += "; includeSubDomains"
+	}
+
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", frame)
+		h.Set("Referrer-Policy", referrer)
+		h.Set("Content-Security-Policy", policy)
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		// browsers ignore hsts over plain http, a proxy ending tls says
+		// so in X-Forwarded-Proto
+		if cfg.HSTS > 0 && (c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https") {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+	}
+}
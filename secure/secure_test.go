@@ -0,0 +1,41 @@
+package secure_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/social-gin/secure"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(secure.Middleware(secure.Config{HSTS: 24 * time.Hour}))
+	r.GET("/hello", func(c *gin.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	for header, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Content-Security-Policy":   secure.DefaultPolicy,
+		"Strict-Transport-Security": "",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Error("given plain http want", header, want, "but get", got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=86400" {
+		t.Error("given https behind proxy want max-age=86400 but get", got)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// Certificate serves a key pair read from files, reloading it when they
+// change so renewed certificates apply without a restart
+type Certificate struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertificate loads the key pair of certFile and keyFile
+func NewCertificate(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: filepath.Clean(certFile), keyFile: filepath.Clean(keyFile)}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the key pair again, the loaded one stays when it fails
+func (c *Certificate) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the loaded key pair, for tls.Config
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Watch reloads the key pair whenever a file in the directories of the
+// cert or key changes until ctx is done, the returned channel is closed once
+// it stopped. Directories are watched rather than files since secrets are
+// usually replaced by swapping a symlink.
+func (c *Certificate) Watch(ctx context.Context, logger *zap.Logger) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{filepath.Dir(c.certFile), filepath.Dir(c.keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	done := make(chan struct{})
+	l := logger.With(zap.String("cert_file", c.certFile))
+	go func() {
+		defer close(done)
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-watcher.Errors:
+				l.Error("watching certificate", zap.Error(err))
+			case event := <-watcher.Events:
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 || !c.watches(event.Name) {
+					continue
+				}
+				// cert and key are written one after the other, a pair not
+				// matching yet is retried on the next write
+				if err := c.Reload(); err != nil {
+					l.Warn("certificate not reloaded", zap.String("event", event.String()), zap.Error(err))
+					continue
+				}
+				l.Info("certificate reloaded")
+			}
+		}
+	}()
+	return done, nil
+}
+
+// watches tells whether a change of name may change the key pair, ..data
+// is the symlink kubernetes swaps to update mounted secrets
+func (c *Certificate) watches(name string) bool {
+	name = filepath.Clean(name)
+	return name == c.certFile || name == c.keyFile || filepath.Base(name) == "..data"
+}
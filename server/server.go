@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+// Options configures the http server
+type Options struct {
+	Addr string `mapstructure:"addr" validate:"required"`
+	// ReadHeaderTimeout bounds reading the request headers, the rest of the
+	// timeouts disable their limit when zero
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout" validate:"gt=0"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout" validate:"gte=0"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout" validate:"gte=0"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout" validate:"gte=0"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes" validate:"gt=0"`
+	TLS               TLS           `mapstructure:"tls"`
+}
+
+// TLS serves https when CertFile and KeyFile are set, both are reloaded
+// when they change
+type TLS struct {
+	CertFile string `mapstructure:"cert_file" validate:"required_with=KeyFile"`
+	KeyFile  string `mapstructure:"key_file" validate:"required_with=CertFile"`
+	// MinVersion is 1.2 or 1.3
+	MinVersion string `mapstructure:"min_version" validate:"omitempty,oneof=1.2 1.3"`
+	// ClientCAFile verifies client certificates of internal callers
+	ClientCAFile string `mapstructure:"client_ca_file" validate:"required_with=ClientAuth"`
+	// ClientAuth is optional, asking callers for a certificate verified when
+	// given, or required, rejecting connections without one
+	ClientAuth string `mapstructure:"client_auth" validate:"omitempty,oneof=optional required"`
+}
+
+// Enabled tells whether https is served
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// New creates server of o serving h, the certificate is nil without TLS
+func New(o Options, h http.Handler) (*http.Server, *Certificate, error) {
+	srv := &http.Server{
+		Addr:              o.Addr,
+		Handler:           h,
+		ReadHeaderTimeout: o.ReadHeaderTimeout,
+		ReadTimeout:       o.ReadTimeout,
+		WriteTimeout:      o.WriteTimeout,
+		IdleTimeout:       o.IdleTimeout,
+		MaxHeaderBytes:    o.MaxHeaderBytes,
+	}
+	if !o.TLS.Enabled() {
+		return srv, nil, nil
+	}
+
+	cert, err := NewCertificate(o.TLS.CertFile, o.TLS.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv.TLSConfig = &tls.Config{
+		GetCertificate: cert.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		// h2 first so clients supporting it get http/2
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if o.TLS.MinVersion == "1.3" {
+		srv.TLSConfig.MinVersion = tls.VersionTLS13
+	}
+	if o.TLS.ClientCAFile != "" {
+		pool, err := certPool(o.TLS.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.TLS.ClientAuth == "required" {
+			srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return srv, cert, nil
+}
+
+func certPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates in client ca %s", file)
+	}
+	return pool, nil
+}
+
+// Serve serves https on ln when srv has a TLS config, http otherwise
+func Serve(srv *http.Server, ln net.Listener) error {
+	if srv.TLSConfig != nil {
+		// the certificate comes from TLSConfig.GetCertificate
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// RequireClientCert rejects requests not made with a verified client
+// certificate, it guards routes for internal callers under mutual TLS
+func RequireClientCert(c *gin.Context) {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		apperror.Abort(c, apperror.Forbidden("client certificate required"))
+	}
+}
@@ -0,0 +1,245 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/server"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// writePair writes a self-signed certificate for localhost named cn and its
+// key into dir, returning the certificate
+func writePair(t *testing.T, dir, cn string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// serve starts srv on a free port, returning its address
+func serve(t *testing.T, srv *http.Server) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(srv, ln)
+	return ln.Addr().String()
+}
+
+func client(roots *x509.CertPool, certs ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+func options(dir string) server.Options {
+	return server.Options{
+		ReadHeaderTimeout: time.Second,
+		MaxHeaderBytes:    1 << 20,
+		TLS: server.TLS{
+			CertFile: filepath.Join(dir, "cert.pem"),
+			KeyFile:  filepath.Join(dir, "key.pem"),
+		},
+	}
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+})
+
+func TestHTTP2AndReload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	first := writePair(t, dir, "first")
+
+	srv, cert, err := server.New(options(dir), ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := cert.Watch(ctx, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cancel()
+		<-done
+	}()
+	addr := serve(t, srv)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(first)
+	resp, err := client(roots).Get("https://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Proto != "HTTP/2.0" {
+		t.Error("want HTTP/2.0 but get", resp.Proto)
+	}
+
+	second := writePair(t, dir, "second")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c, _ := cert.GetCertificate(nil)
+		if c.Leaf == nil {
+			c.Leaf, _ = x509.ParseCertificate(c.Certificate[0])
+		}
+		if c.Leaf.Subject.CommonName == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("given new key pair written want it reloaded but get", c.Leaf.Subject.CommonName)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	roots = x509.NewCertPool()
+	roots.AddCert(second)
+	resp, err = client(roots).Get("https://" + addr)
+	if err != nil {
+		t.Fatal("given reloaded certificate want it served but get", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRequiredClientCert(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ca := writePair(t, dir, "server")
+
+	o := options(dir)
+	o.TLS.ClientCAFile = o.TLS.CertFile
+	o.TLS.ClientAuth = "required"
+	srv, _, err := server.New(o, ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	addr := serve(t, srv)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	if resp, err := client(roots).Get("https://" + addr); err == nil {
+		resp.Body.Close()
+		t.Error("given no client certificate want handshake error but get", resp.Status)
+	}
+
+	pair, err := tls.LoadX509KeyPair(o.TLS.CertFile, o.TLS.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client(roots, pair).Get("https://" + addr)
+	if err != nil {
+		t.Fatal("given client certificate want ok but get", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRequireClientCert(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ca := writePair(t, dir, "server")
+
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.GET("/metrics", server.RequireClientCert, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Error("given plain http want 403 but get", rec.Code)
+	}
+
+	o := options(dir)
+	o.TLS.ClientCAFile = o.TLS.CertFile
+	o.TLS.ClientAuth = "optional"
+	srv, _, err := server.New(o, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	addr := serve(t, srv)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	resp, err := client(roots).Get("https://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Error("given https without client certificate want 403 but get", resp.StatusCode)
+	}
+
+	pair, err := tls.LoadX509KeyPair(o.TLS.CertFile, o.TLS.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client(roots, pair).Get("https://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error("given verified client certificate want 200 but get", resp.StatusCode)
+	}
+}
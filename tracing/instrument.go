@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// InstrumentGORM adds a child span for every query run with the context of a
+// traced request, queries of background jobs aren't traced
+func InstrumentGORM(db *gorm.DB) error {
+	before := func(operation string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			ctx := db.Statement.Context
+			if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+				return
+			}
+			_, span := tracer().Start(ctx, "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemMSSQL, semconv.DBOperationKey.String(operation)),
+			)
+			db.InstanceSet(spanKey, span)
+		}
+	}
+	after := func(db *gorm.DB) {
+		v, ok := db.InstanceGet(spanKey)
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		defer span.End()
+		span.SetAttributes(
+			semconv.DBSQLTableKey.String(db.Statement.Table),
+			semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		)
+		if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redis returns a copy of client bound to ctx adding a child span for every
+// command, the client itself is left untouched. The copy is cheap, make one
+// per request.
+func Redis(ctx context.Context, client *redis.Client) *redis.Client {
+	c := client.WithContext(ctx)
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return c
+	}
+	c.WrapProcess(func(process func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			_, span := tracer().Start(ctx, "redis."+strings.ToLower(cmd.Name()),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperationKey.String(strings.ToLower(cmd.Name()))),
+			)
+			defer span.End()
+			err := process(cmd)
+			if err != nil && err != redis.Nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	})
+	return c
+}
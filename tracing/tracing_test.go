@@ -0,0 +1,115 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/social-gin/logger"
+	"example.com/social-gin/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/protobuf/proto"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := tracing.Setup("test", exporter, 1)
+	core, logs := observer.New(zap.InfoLevel)
+
+	r := gin.New()
+	r.Use(tracing.Middleware(), logger.Middleware(zap.New(core)))
+	r.GET("/users/:uid", func(c *gin.Context) {
+		logger.Extract(c).Info("handler")
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("traceparent", parent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	tp.ForceFlush(context.Background())
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatal("want 1 span but get", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /users/:uid" {
+		t.Error("want span name GET /users/:uid but get", span.Name)
+	}
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error("want trace continued from traceparent but get", span.SpanContext.TraceID())
+	}
+	if span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Error("want parent span from traceparent but get", span.Parent.SpanID())
+	}
+	if span.Status.Code != codes.Error {
+		t.Error("want error status for 500 but get", span.Status.Code)
+	}
+
+	for _, entry := range logs.All() {
+		if entry.ContextMap()["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Error("want trace id in log", entry.Message, "but get", entry.ContextMap())
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body coltracepb.ExportTraceServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Error("want path /v1/traces but get", r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Error("want protobuf content type but get", r.Header.Get("Content-Type"))
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error("can't read body", err)
+		}
+		if err := proto.Unmarshal(b, &body); err != nil {
+			t.Error("can't decode body", err)
+		}
+	}))
+	defer srv.Close()
+
+	exporter, err := tracing.NewExporter("otlp", srv.URL+"/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := tracing.Setup("test", exporter, 1)
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.GET("/hello", func(c *gin.Context) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	req.Header.Set("traceparent", parent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatal("shutdown failed", err)
+	}
+
+	if len(body.ResourceSpans) == 0 || len(body.ResourceSpans[0].ScopeSpans) == 0 || len(body.ResourceSpans[0].ScopeSpans[0].Spans) == 0 {
+		t.Fatal("want a span exported but get", body.String())
+	}
+	span := body.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if get := hex.EncodeToString(span.TraceId); get != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error("want trace id from traceparent but get", get)
+	}
+	if span.Name != "GET /hello" {
+		t.Error("want span name GET /hello but get", span.Name)
+	}
+	if span.Kind != tracepb.Span_SPAN_KIND_SERVER {
+		t.Error("want server kind but get", span.Kind)
+	}
+}
@@ -0,0 +1,108 @@
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Dependent is data owned by a user that follows the user soft-delete
+type Dependent interface {
+	// SoftDeleteOwned soft-deletes rows of uid, stamping them with at
+	SoftDeleteOwned(tx *gorm.DB, uid uint, at time.Time) error
+	// RestoreOwned restores rows of uid soft-deleted at the same time as the user
+	RestoreOwned(tx *gorm.DB, uid uint, at time.Time) error
+	// PurgeOwned hard-deletes every row of uid
+	PurgeOwned(tx *gorm.DB, uid uint) error
+}
+
+// RestoreUser handle restore deleted user request, the user proves it's them
+// with the same credentials as LogIn
+func (h *Handler) RestoreUser(c *gin.Context) {
+	uid, err := strconv.Atoi(c.Param("uid"))
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
+		return
+	}
+
+	user := User{}
+	if result := h.db(c).Unscoped().Where("deleted_at is not null").First(&user, uid); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+
+	if user.Username != c.Request.FormValue("u") || user.Password != c.Request.FormValue("p") {
+		h.Audit.RecordDenied(c, audit.Event{
+			Action: "user.restore_failed",
+			Target: target(user.ID),
+			Detail: "wrong username or password",
+		})
+		apperror.Abort(c, apperror.Unauthorized("invalid username or password"))
+		return
+	}
+
+	deletedAt := user.DeletedAt.Time
+	if h.RestoreGrace > 0 && time.Since(deletedAt) > h.RestoreGrace {
+		apperror.Abort(c, apperror.Gone("user was deleted too long ago to be restored"))
+		return
+	}
+
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		for _, d := range h.Dependents {
+			if err := d.RestoreOwned(tx, user.ID, deletedAt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		apperror.Abort(c, apperror.Internal(err))
+		return
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	h.Audit.Record(c, audit.Event{
+		Actor:  strconv.Itoa(int(user.ID)),
+		Action: "user.restore",
+		Target: target(user.ID),
+	})
+	c.JSON(http.StatusOK, view(c, user))
+}
+
+// Purge hard-deletes users soft-deleted before the given time with
+// everything they own, returning how many users were purged. A user that
+// can't be purged is logged and left for the next run.
+func (h *Handler) Purge(before time.Time) (int, error) {
+	users := []User{}
+	if err := h.DB.Unscoped().Where("deleted_at < ?", before).Find(&users).Error; err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, user := range users {
+		if err := h.purge(user); err != nil {
+			zap.L().Error("can't purge user", zap.Uint("uid", user.ID), zap.Error(err))
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (h *Handler) purge(user User) error {
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		for _, d := range h.Dependents {
+			if err := d.PurgeOwned(tx, user.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+}
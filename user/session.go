@@ -0,0 +1,179 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// Session configures cookie sessions, so browser clients keep no token
+// where scripts can read it. Sessions are off when TTL is zero.
+type Session struct {
+	// CookieName holds the session token, session when empty
+	CookieName string `mapstructure:"cookie_name"`
+	// TTL is how long an idle session lasts, each request slides it
+	TTL time.Duration `mapstructure:"ttl" validate:"gte=0"`
+	// MaxAge bounds a session however active, no bound when zero
+	MaxAge time.Duration `mapstructure:"max_age" validate:"gte=0"`
+	// Secure sends the cookie over https only
+	Secure bool `mapstructure:"secure"`
+	// SameSite is lax when empty, none needs Secure
+	SameSite string `mapstructure:"same_site" validate:"omitempty,oneof=lax strict none"`
+}
+
+// Cookie returns the name of the session cookie
+func (s Session) Cookie() string {
+	if s.CookieName == "" {
+		return "session"
+	}
+	return s.CookieName
+}
+
+func (s Session) sameSite() http.SameSite {
+	switch s.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// wantsSession tells whether the login asks for a session cookie instead of
+// a token in the body
+func wantsSession(c *gin.Context) bool {
+	session, _ := strconv.ParseBool(c.Request.FormValue("session"))
+	return session
+}
+
+// issueSession creates a session token of the user, marked so it's only
+// accepted from the cookie
+func (h *Handler) issueSession(ctx context.Context, uid uint) (string, error) {
+	value, err := json.Marshal(Grant{
+		UID:     strconv.Itoa(int(uid)),
+		Session: true,
+		Created: time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	token := uuid.New().String()
+	if err := store(tracing.Redis(ctx, h.RedisClient), token, value, strconv.Itoa(int(uid)), h.Session.TTL); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// setSessionCookie hands token to the browser, scripts can't read it
+func (h *Handler) setSessionCookie(c *gin.Context, token string) {
+	cookie := &http.Cookie{
+		Name:     h.Session.Cookie(),
+		Value:    token,
+		Path:     "/",
+		Secure:   h.Session.Secure,
+		HttpOnly: true,
+		SameSite: h.Session.sameSite(),
+	}
+	// without a bound the cookie goes with the browser, the store still
+	// ends it once idle
+	if h.Session.MaxAge > 0 {
+		cookie.MaxAge = int(h.Session.MaxAge.Seconds())
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// clearSessionCookie makes the browser drop the session cookie
+func (h *Handler) clearSessionCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     h.Session.Cookie(),
+		Value:    "",
+		Path:     "/",
+		Secure:   h.Session.Secure,
+		HttpOnly: true,
+		SameSite: h.Session.sameSite(),
+		MaxAge:   -1,
+	})
+}
+
+// token returns the bearer token of the request, or else its session cookie
+func (h *Handler) token(c *gin.Context) (token string, session bool) {
+	auth := c.GetHeader("Authorization")
+	prefix := "Bearer "
+	if strings.HasPrefix(auth, prefix) {
+		return auth[len(prefix):], false
+	}
+	if h.Session.TTL > 0 {
+		if cookie, err := c.Cookie(h.Session.Cookie()); err == nil && cookie != "" {
+			return cookie, true
+		}
+	}
+	return "", false
+}
+
+// slide extends the session by TTL on activity, never past MaxAge. It
+// reports false when the session is over.
+func (h *Handler) slide(ctx context.Context, token string, grant Grant) (bool, error) {
+	rds := tracing.Redis(ctx, h.RedisClient)
+	ttl := h.Session.TTL
+	if h.Session.MaxAge > 0 {
+		left := time.Until(time.Unix(grant.Created, 0).Add(h.Session.MaxAge))
+		if left <= 0 {
+			return false, rds.Del(token).Err()
+		}
+		if left < ttl {
+			ttl = left
+		}
+	}
+	if err := rds.Expire(token, ttl).Err(); err != nil {
+		return false, err
+	}
+	return true, keep(rds, tokensKey(grant.UID), ttl)
+}
+
+// LogOut ends the session of the request and clears its cookie, a bearer
+// token is revoked the same way
+func (h *Handler) LogOut(c *gin.Context) {
+	token, session := h.token(c)
+	if session {
+		h.clearSessionCookie(c)
+	}
+	if token == "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	rds := tracing.Redis(c.Request.Context(), h.RedisClient)
+	value, err := rds.Get(token).Result()
+	if err == redis.Nil {
+		// already expired, the cookie is cleared all the same
+		c.Status(http.StatusNoContent)
+		return
+	} else if err != nil {
+		apperror.Abort(c, apperror.Unavailable(err))
+		return
+	}
+	if err := rds.Del(token).Err(); err != nil {
+		apperror.Abort(c, apperror.Unavailable(err))
+		return
+	}
+
+	if grant, err := parseGrant(value); err == nil {
+		uid, _ := strconv.Atoi(grant.UID)
+		h.Audit.Record(c, audit.Event{
+			Actor:  grant.UID,
+			Action: "user.logout",
+			Target: target(uint(uid)),
+		})
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,145 @@
+package user_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/user"
+)
+
+// session logs blink in with a session cookie
+func (s *server) session(t *testing.T) *http.Cookie {
+	rec := s.form("/login", url.Values{"u": {"blink"}, "p": {"password"}, "session": {"true"}})
+	if rec.Code != http.StatusNoContent {
+		t.Fatal("session login want 204 but get", rec.Code, rec.Body.String())
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session" {
+			return c
+		}
+	}
+	t.Fatal("want session cookie but get", rec.Header())
+	return nil
+}
+
+// me requests /me with the session cookie
+func (s *server) me(cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.AddCookie(cookie)
+	return s.do(req)
+}
+
+func sessions(t *testing.T) *server {
+	s := setup(t)
+	s.h.Session = user.Session{TTL: time.Minute, MaxAge: time.Hour}
+	s.create(t)
+	return s
+}
+
+func TestSessionSlides(t *testing.T) {
+	s := sessions(t)
+	cookie := s.session(t)
+
+	s.redis.FastForward(40 * time.Second)
+	if rec := s.me(cookie); rec.Code != http.StatusOK {
+		t.Fatal("given active session want 200 but get", rec.Code)
+	}
+	if ttl := s.redis.TTL(cookie.Value); ttl != time.Minute {
+		t.Error("given request after 40s want ttl slid back to 1m but get", ttl)
+	}
+
+	s.redis.FastForward(2 * time.Minute)
+	if rec := s.me(cookie); rec.Code != http.StatusUnauthorized {
+		t.Error("given session idle past ttl want 401 but get", rec.Code)
+	}
+}
+
+// seed stores a session token of blink started at created
+func (s *server) seed(t *testing.T, created time.Time) *http.Cookie {
+	value, _ := json.Marshal(user.Grant{UID: "1", Session: true, Created: created.Unix()})
+	if err := s.redis.Set("seeded", string(value)); err != nil {
+		t.Fatal(err)
+	}
+	s.redis.SetTTL("seeded", time.Minute)
+	return &http.Cookie{Name: "session", Value: "seeded"}
+}
+
+func TestSessionMaxAge(t *testing.T) {
+	s := sessions(t)
+
+	cookie := s.seed(t, time.Now().Add(-time.Hour+30*time.Second))
+	if rec := s.me(cookie); rec.Code != http.StatusOK {
+		t.Fatal("given session within max age want 200 but get", rec.Code)
+	}
+	if ttl := s.redis.TTL(cookie.Value); ttl > 30*time.Second {
+		t.Error("given 30s left of max age want ttl cut to it but get", ttl)
+	}
+
+	cookie = s.seed(t, time.Now().Add(-2*time.Hour))
+	rec := s.me(cookie)
+	if rec.Code != http.StatusUnauthorized {
+		t.Error("given session past max age want 401 but get", rec.Code)
+	}
+	if s.redis.Exists(cookie.Value) {
+		t.Error("given session past max age want it deleted")
+	}
+	cleared := false
+	for _, c := range rec.Result().Cookies() {
+		cleared = cleared || c.Name == "session" && c.MaxAge < 0
+	}
+	if !cleared {
+		t.Error("given session past max age want cookie cleared but get", rec.Header()["Set-Cookie"])
+	}
+}
+
+func TestSessionTokenAsBearer(t *testing.T) {
+	s := sessions(t)
+	cookie := s.session(t)
+
+	if rec := s.bearer(http.MethodGet, "/me", cookie.Value); rec.Code != http.StatusUnauthorized {
+		t.Error("given session token as bearer want 401 but get", rec.Code)
+	}
+	if rec := s.me(cookie); rec.Code != http.StatusOK {
+		t.Error("given session token from the cookie want 200 but get", rec.Code)
+	}
+}
+
+func TestSessionsExport(t *testing.T) {
+	s := sessions(t)
+	token := s.login(t)
+	cookie := s.session(t)
+	grant, err := s.h.IssueGrantToken(user.Grant{UID: "1", ClientID: "app", Scopes: []string{"profile"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.redis.SAdd("user:tokens:1", "expired")
+
+	got, err := s.h.Sessions(s.db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(got)
+	for _, secret := range []string{token, cookie.Value, grant} {
+		if strings.Contains(string(b), secret) {
+			t.Error("want export without token secrets but get", string(b))
+		}
+	}
+	kinds := map[string]user.ActiveGrant{}
+	for _, g := range got.([]user.ActiveGrant) {
+		kinds[g.Kind] = g
+	}
+	if len(got.([]user.ActiveGrant)) != 3 || len(kinds) != 3 {
+		t.Fatal("want a token, a session and an oauth grant but get", string(b))
+	}
+	if kinds["session"].CreatedAt == nil || kinds["oauth"].ClientID != "app" {
+		t.Error("want session start and oauth client but get", string(b))
+	}
+	if left := time.Until(kinds["token"].ExpiresAt); left <= 9*time.Minute || left > 10*time.Minute {
+		t.Error("want token expiring in 10m but get", kinds["token"].ExpiresAt)
+	}
+}
@@ -0,0 +1,176 @@
+package user
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Grant represents what a third-party access token allows. Tokens issued by
+// LogIn only hold the user id and grant everything the user can do.
+type Grant struct {
+	UID      string   `json:"uid,omitempty"`
+	ClientID string   `json:"client_id"`
+	Scopes   []string `json:"scopes"`
+	// Session marks cookie session tokens, which are only accepted from
+	// the cookie and slide their expiry
+	Session bool `json:"session,omitempty"`
+	// Created is when the session started in unix seconds
+	Created int64 `json:"created,omitempty"`
+}
+
+// IssueGrantToken creates access token for a third-party client
+func (h *Handler) IssueGrantToken(grant Grant, ttl time.Duration) (string, error) {
+	value, err := json.Marshal(grant)
+	if err != nil {
+		return "", err
+	}
+	token := uuid.New().String()
+	if grant.UID == "" {
+		// client credentials tokens act for no user
+		if err := h.RedisClient.Set(token, value, ttl).Err(); err != nil {
+			return "", err
+		}
+		return token, nil
+	}
+	if err := store(h.RedisClient, token, value, grant.UID, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tokensKey is the set of tokens issued for uid, so they can be revoked
+// together
+func tokensKey(uid string) string {
+	return "user:tokens:" + uid
+}
+
+// store saves token of uid and adds it to the tokens of uid
+func store(rds *redis.Client, token string, value interface{}, uid string, ttl time.Duration) error {
+	if err := rds.Set(token, value, ttl).Err(); err != nil {
+		return err
+	}
+	if err := rds.SAdd(tokensKey(uid), token).Err(); err != nil {
+		return err
+	}
+	return keep(rds, tokensKey(uid), ttl)
+}
+
+// keep extends the expiry of key to at least ttl, the token set lives as
+// long as its longest token
+func keep(rds *redis.Client, key string, ttl time.Duration) error {
+	left, err := rds.TTL(key).Result()
+	if err != nil {
+		return err
+	}
+	if left < ttl {
+		return rds.Expire(key, ttl).Err()
+	}
+	return nil
+}
+
+// revokeTokens deletes every token issued for uid
+func revokeTokens(rds *redis.Client, uid string) error {
+	tokens, err := rds.SMembers(tokensKey(uid)).Result()
+	if err != nil {
+		return err
+	}
+	return rds.Del(append(tokens, tokensKey(uid))...).Err()
+}
+
+// ActiveGrant represents a token of the user in the data export, without
+// the token itself
+type ActiveGrant struct {
+	// Kind is session, token or oauth
+	Kind      string     `json:"kind"`
+	ClientID  string     `json:"client_id,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// Sessions is the data export source of the tokens the user has in use,
+// sessions, login tokens and the tokens of oauth clients
+func (h *Handler) Sessions(db *gorm.DB, uid uint) (interface{}, error) {
+	tokens, err := h.RedisClient.SMembers(tokensKey(strconv.Itoa(int(uid)))).Result()
+	if err != nil {
+		return nil, err
+	}
+	grants := []ActiveGrant{}
+	for _, token := range tokens {
+		value, err := h.RedisClient.Get(token).Result()
+		if err == redis.Nil {
+			// expired or logged out, the set only goes when the last does
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ttl, err := h.RedisClient.TTL(token).Result()
+		if err != nil {
+			return nil, err
+		}
+		grant, err := parseGrant(value)
+		if err != nil {
+			return nil, err
+		}
+
+		g := ActiveGrant{Kind: "token", ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second)}
+		switch {
+		case grant.Session:
+			g.Kind = "session"
+		case grant.ClientID != "":
+			g.Kind = "oauth"
+			g.ClientID = grant.ClientID
+			g.Scopes = grant.Scopes
+		}
+		if grant.Created != 0 {
+			created := time.Unix(grant.Created, 0).UTC()
+			g.CreatedAt = &created
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// parseGrant reads the token value stored in redis
+func parseGrant(value string) (Grant, error) {
+	grant := Grant{}
+	if !strings.HasPrefix(value, "{") {
+		grant.UID = value
+		return grant, nil
+	}
+	err := json.Unmarshal([]byte(value), &grant)
+	return grant, err
+}
+
+// RequireScope rejects third-party tokens that weren't granted scope,
+// it must run after Authorize
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get("scopes")
+		if !ok {
+			return
+		}
+		for _, s := range v.([]string) {
+			if s == scope {
+				return
+			}
+		}
+		apperror.Abort(c, apperror.Forbidden("token has no "+scope+" scope"))
+	}
+}
+
+// RequireFirstParty rejects tokens issued to third-party clients,
+// it must run after Authorize
+func RequireFirstParty(c *gin.Context) {
+	if c.GetString("client_id") != "" {
+		apperror.Abort(c, apperror.Forbidden("not allowed for third-party clients"))
+	}
+}
@@ -1,15 +1,20 @@
 package user
 
 import (
+	"context"
 	"database/sql"
-	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/csrf"
+	"example.com/social-gin/etag"
 	"example.com/social-gin/logger"
+	"example.com/social-gin/patch"
+	"example.com/social-gin/tracing"
+	"example.com/social-gin/validation"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis"
 	"github.com/google/uuid"
@@ -19,20 +24,50 @@ import (
 
 // User represents user data
 type User struct {
-	ID        uint         `gorm:"primarykey" json:"id"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"update_at"`
-	DeletedAt sql.NullTime `gorm:"index" json:"-"`
-	Username  string       `gorm:"uniquekey" json:"username"`
-	Password  string       `json:"password"`
-	Name      string       `json:"name"`
-	Email     string       `json:"email"`
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"update_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Username  string         `gorm:"uniquekey" json:"username"`
+	Password  string         `json:"password"`
+	Name      string         `json:"name"`
+	Email     string         `json:"email"`
+	// Version increases on every write, it's the ETag of the user
+	Version uint `gorm:"not null;default:1" json:"-"`
 }
 
+// UserRequest represents body of add, replace and patch user request
+type UserRequest struct {
+	Username string `json:"username" form:"username" binding:"required,min=3,max=32,username"`
+	Password string `json:"password" form:"password" binding:"required,min=8,max=72,password"`
+	Name     string `json:"name" form:"name" binding:"max=100"`
+	Email    string `json:"email" form:"email" binding:"required,max=254,email"`
+}
+
+// patchable lists the user fields a patch may change
+var patchable = []string{"username", "password", "name", "email"}
+
 // Handler represents handler of user data
 type Handler struct {
 	DB          *gorm.DB
 	RedisClient *redis.Client
+	// Dependents are deleted, restored and purged together with their user
+	Dependents []Dependent
+	// RestoreGrace is how long a deleted user can be restored, zero means forever
+	RestoreGrace time.Duration
+	// RequireIfMatch rejects writes without If-Match header
+	RequireIfMatch bool
+	// Audit records writes, logins and denied access, nothing when nil
+	Audit *audit.Trail
+	// Session lets LogIn set a session cookie Authorize accepts
+	Session Session
+	// CSRF token cookie is rotated when a session starts
+	CSRF csrf.Config
+	// TokenTTL is how long a login token lasts
+	TokenTTL time.Duration
+	// GetTokenTTL, when set, is called for every token instead of TokenTTL
+	// so it can change while serving
+	GetTokenTTL func() time.Duration
 }
 
 // Hello handles hello request
@@ -50,13 +85,12 @@ func (h *Handler) ListTable(c *gin.Context) {
 	uid := c.GetString("uid")
 	logger.Info("listing table", zap.String("uid", uid))
 
-	rows, err := h.DB.Raw("sp_tables").Rows()
+	rows, err := h.db(c).Raw("sp_tables").Rows()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.Internal(err))
 		return
 	}
+	defer rows.Close()
 
 	tables := []string{}
 	var tableQualifier sql.NullString
@@ -67,9 +101,7 @@ func (h *Handler) ListTable(c *gin.Context) {
 	for rows.Next() {
 
 		if err := rows.Scan(&tableQualifier, &tableOwner, &tableName, &tableType, &remarks); err != nil {
-			c.JSON(http.StatusBadRequest, map[string]interface{}{
-				"error": err.Error(),
-			})
+			apperror.Abort(c, apperror.Internal(err))
 			return
 		}
 		tables = append(tables, tableName.String)
@@ -79,123 +111,153 @@ func (h *Handler) ListTable(c *gin.Context) {
 
 // AddUser handle add user request
 func (h *Handler) AddUser(c *gin.Context) {
-	user := User{}
-	if err := c.Bind(&user); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	req := UserRequest{}
+	err := validation.Bind(c, &req)
+	if err := h.checkUnique(c, 0, req.Username, req.Email, err); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
-	if result := h.DB.Create(&user); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+
+	user := User{
+		Username: req.Username,
+		Password: req.Password,
+		Name:     req.Name,
+		Email:    req.Email,
+		Version:  1,
+	}
+	if result := h.db(c).Create(&user); result.Error != nil {
+		apperror.Abort(c, result.Error)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	h.Audit.Record(c, audit.Event{
+		Actor:  strconv.Itoa(int(user.ID)),
+		Action: "user.create",
+		Target: target(user.ID),
+		After:  user,
+	})
+	etag.Set(c, user.Version)
+	c.JSON(http.StatusOK, view(c, user))
 }
 
 // ListUser handle list user request
 func (h *Handler) ListUser(c *gin.Context) {
 	users := []User{}
-	if result := h.DB.Find(&users); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := h.db(c).Find(&users); result.Error != nil {
+		apperror.Abort(c, result.Error)
 		return
 	}
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, viewList(c, users))
 }
 
 // GetUser handle list user request
 func (h *Handler) GetUser(c *gin.Context) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
 		return
 	}
 	user := User{}
-	if result := h.DB.First(&user, uid); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := h.db(c).First(&user, uid); result.Error != nil {
+		apperror.Abort(c, result.Error)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	if etag.NotModified(c, user.Version) {
+		return
+	}
+	c.JSON(http.StatusOK, view(c, user))
 }
 
-// UpdateUser handle update user request
+// UpdateUser handle replace user request, every field is overwritten
 func (h *Handler) UpdateUser(c *gin.Context) {
+	user, ok := h.ownUser(c)
+	if !ok {
+		return
+	}
+
+	req := UserRequest{}
+	err := validation.Bind(c, &req)
+	h.save(c, user, req, err)
+}
+
+// PatchUser handle patch user request with merge patch or json patch body
+func (h *Handler) PatchUser(c *gin.Context) {
+	user, ok := h.ownUser(c)
+	if !ok {
+		return
+	}
+
+	current := UserRequest{
+		Username: user.Username,
+		Password: user.Password,
+		Name:     user.Name,
+		Email:    user.Email,
+	}
+	req := UserRequest{}
+	err := patch.Bind(c, current, patchable, &req)
+	h.save(c, user, req, err)
+}
+
+// ownUser loads the user of the uid param, which must be the login user
+func (h *Handler) ownUser(c *gin.Context) (*User, bool) {
 	uid, err := strconv.Atoi(c.Param("uid"))
 
 	loginUid := c.MustGet("uid")
 
-	// c.Get("uid").(string)
-
 	if loginUid != c.Param("uid") {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "unauthorized user",
-		})
-		return
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
+		return nil, false
 	}
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
-		return
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
+		return nil, false
 	}
-	user := User{}
-	if result := h.DB.First(&user, uid); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
-		return
+	user := &User{}
+	if result := h.db(c).First(user, uid); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return nil, false
 	}
+	if err := etag.Check(c, user.Version, h.RequireIfMatch); err != nil {
+		apperror.Abort(c, err)
+		return nil, false
+	}
+	return user, true
+}
 
-	updateUser := User{}
-	if err := c.Bind(&updateUser); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+// save stores req as the new state of user, err is the error of binding req
+func (h *Handler) save(c *gin.Context, user *User, req UserRequest, err error) {
+	if err := h.checkUnique(c, user.ID, req.Username, req.Email, err); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	// update fields
-	if updateUser.Username != "" {
-		user.Username = updateUser.Username
-	}
-	if updateUser.Password != "" {
-		user.Password = updateUser.Password
-	}
-	if updateUser.Name != "" {
-		user.Name = updateUser.Name
-	}
-	if updateUser.Email != "" {
-		user.Email = updateUser.Email
+	before := *user
+	version := user.Version
+	user.Username = req.Username
+	user.Password = req.Password
+	user.Name = req.Name
+	user.Email = req.Email
+	user.Version++
+
+	// only write when nobody else has written since the user was loaded
+	result := h.db(c).Model(user).Where("version = ?", version).
+		Select("username", "password", "name", "email", "version").Updates(user)
+	if result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
 	}
-
-	if result := h.DB.Save(&user); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result.RowsAffected == 0 {
+		apperror.Abort(c, etag.Modified())
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	h.Audit.Record(c, audit.Event{
+		Action: "user.update",
+		Target: target(user.ID),
+		Before: before,
+		After:  *user,
+	})
+	etag.Set(c, user.Version)
+	c.JSON(http.StatusOK, view(c, *user))
 }
 
 // DeleteUser handle delete user request
@@ -205,80 +267,188 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 	loginUid := c.MustGet("uid")
 
 	if loginUid != c.Param("uid") {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "unauthorized user",
-		})
+		apperror.Abort(c, apperror.Forbidden("unauthorized user"))
 		return
 	}
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		apperror.Abort(c, apperror.BadRequest("invalid user id"))
 		return
 	}
+	// permanent delete also drops a user already in the trash
+	permanent := c.Query("permanent") == "true"
+	db := h.db(c)
+	if permanent {
+		db = db.Unscoped()
+	}
 	user := User{}
-	if result := h.DB.First(&user, uid); result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, map[string]interface{}{
-				"error": result.Error.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := db.First(&user, uid); result.Error != nil {
+		apperror.Abort(c, result.Error)
+		return
+	}
+	if err := etag.Check(c, user.Version, h.RequireIfMatch); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result := h.DB.Delete(&user); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": result.Error.Error(),
+	// soft-delete the user along with everything it owns, or drop it all for good
+	var deleteErr error
+	action := "user.delete"
+	if permanent {
+		action = "user.purge"
+		deleteErr = h.purge(user)
+	} else {
+		deleteErr = h.db(c).Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			result := tx.Model(&user).Where("version = ?", user.Version).Update("deleted_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return etag.Modified()
+			}
+			for _, d := range h.Dependents {
+				if err := d.SoftDeleteOwned(tx, user.ID, now); err != nil {
+					return err
+				}
+			}
+			return nil
 		})
+	}
+	if deleteErr != nil {
+		apperror.Abort(c, deleteErr)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	// a deleted user is logged out everywhere, after a restore they log in again
+	if err := revokeTokens(tracing.Redis(c.Request.Context(), h.RedisClient), strconv.Itoa(int(user.ID))); err != nil {
+		apperror.Abort(c, apperror.Unavailable(err))
+		return
+	}
+	h.Audit.Record(c, audit.Event{Action: action, Target: target(user.ID), Before: user})
+	c.JSON(http.StatusOK, view(c, user))
+}
+
+// db returns the database bound to the request context so queries join
+// the trace of the request
+func (h *Handler) db(c *gin.Context) *gorm.DB {
+	return h.DB.WithContext(c.Request.Context())
+}
+
+// checkUnique adds the username and email already taken by another user to
+// err from binding the request, so one response lists every invalid field
+func (h *Handler) checkUnique(c *gin.Context, id uint, username, email string, err error) error {
+	invalid, ok := validation.Invalid(err)
+	if err != nil && !ok {
+		return err
+	}
+	fields := []apperror.FieldError{}
+	for _, f := range [][2]string{{"username", username}, {"email", email}} {
+		column, value := f[0], f[1]
+		if value == "" || hasField(invalid, column) {
+			continue
+		}
+		// soft-deleted users keep their username and email until purged
+		var count int64
+		if err := h.db(c).Unscoped().Model(&User{}).Where(column+" = ? and id <> ?", value, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			fields = append(fields, validation.Field(column, "unique", ""))
+		}
+	}
+	return validation.Merge(err, fields...)
 }
 
-// LogIn handle login request
+func hasField(fields []apperror.FieldError, name string) bool {
+	for _, f := range fields {
+		if f.Field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LogIn handle login request. With session=true it sets a session cookie
+// instead of returning the token.
 func (h *Handler) LogIn(c *gin.Context) {
 
 	username := c.Request.FormValue("u")
 	password := c.Request.FormValue("p")
+	session := wantsSession(c)
+	if session && h.Session.TTL <= 0 {
+		apperror.Abort(c, apperror.BadRequest("session cookies are not enabled"))
+		return
+	}
 
 	l := logger.Extract(c)
 
-	l.Info(fmt.Sprint("login username=", username, " password=", password))
+	l.Info("login", zap.String("username", username))
 
 	user := User{}
 
-	if result := h.DB.Where("Username = ?", username).Limit(1).Find(&user); result.Error != nil {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": result.Error.Error(),
-		})
+	if result := h.db(c).Where("Username = ?", username).Limit(1).Find(&user); result.Error != nil {
+		apperror.Abort(c, apperror.Internal(result.Error))
 		return
 	} else if result.RowsAffected == 0 {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "invalid username or password",
+		h.Audit.RecordDenied(c, audit.Event{
+			Action: "user.login_failed",
+			Target: "users?username=" + username,
+			Detail: "unknown username",
 		})
+		apperror.Abort(c, apperror.Unauthorized("invalid username or password"))
 		return
 	}
 
 	if user.Password != password {
-		c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "invalid username or password",
+		h.Audit.RecordDenied(c, audit.Event{
+			Action: "user.login_failed",
+			Target: target(user.ID),
+			Detail: "wrong password",
 		})
+		apperror.Abort(c, apperror.Unauthorized("invalid username or password"))
 		return
 	}
 
-	token := uuid.New().String()
+	// a new csrf token goes with a new session, made first so a failure
+	// leaves no session behind
+	var csrfToken string
+	if session && h.CSRF.Enabled {
+		var err error
+		if csrfToken, err = csrf.New(); err != nil {
+			apperror.Abort(c, apperror.Internal(err))
+			return
+		}
+	}
 
-	l.Info(fmt.Sprint("new token=", token))
+	var token string
+	var err error
+	if session {
+		token, err = h.issueSession(c.Request.Context(), user.ID)
+	} else {
+		token, err = h.issueToken(c.Request.Context(), user.ID)
+	}
+	if err != nil {
+		apperror.Abort(c, apperror.Unavailable(err))
+		return
+	}
 
-	if _, err := h.RedisClient.Set(token, user.ID, time.Minute*10).Result(); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+	l.Info("logged in", zap.Uint("uid", user.ID), zap.Bool("session", session))
+	event := audit.Event{
+		Actor:  strconv.Itoa(int(user.ID)),
+		Action: "user.login",
+		Target: target(user.ID),
+	}
+	if session {
+		event.Detail = "session cookie"
+	}
+	h.Audit.Record(c, event)
+
+	if session {
+		h.setSessionCookie(c, token)
+		if h.CSRF.Enabled {
+			csrf.SetCookie(c, h.CSRF, csrfToken)
+		}
+		c.Status(http.StatusNoContent)
 		return
 	}
 
@@ -287,41 +457,95 @@ func (h *Handler) LogIn(c *gin.Context) {
 	})
 }
 
-// Authorize authenticate using authorization header
-func (h *Handler) Authorize(c *gin.Context) {
+// IssueToken creates access token of the user
+func (h *Handler) IssueToken(uid uint) (string, error) {
+	return h.issueToken(context.Background(), uid)
+}
+
+func (h *Handler) issueToken(ctx context.Context, uid uint) (string, error) {
+	ttl := h.TokenTTL
+	if h.GetTokenTTL != nil {
+		ttl = h.GetTokenTTL()
+	}
+	token := uuid.New().String()
+	if err := store(tracing.Redis(ctx, h.RedisClient), token, uid, strconv.Itoa(int(uid)), ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
 
-	auth := c.GetHeader("Authorization")
-	prefix := "Bearer "
+// Authorize authenticate using authorization header or session cookie
+func (h *Handler) Authorize(c *gin.Context) {
 
-	if !strings.HasPrefix(auth, prefix) {
-		c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": "no authorization token found in the header",
-		})
-		c.Abort()
+	token, session := h.token(c)
+	if token == "" {
+		// not audited, anonymous requests are no attempt to get in
+		apperror.Abort(c, apperror.Unauthorized("no authorization token found in the header or session cookie"))
 		return
 	}
 
-	token := auth[len(prefix):]
-
 	// validate token
 
-	var uid string
+	var value string
 	var err error
-	if uid, err = h.RedisClient.Get(token).Result(); err != nil {
-		// can't connect to redis
+	if value, err = tracing.Redis(c.Request.Context(), h.RedisClient).Get(token).Result(); err != nil {
 		if err == redis.Nil {
-			c.JSON(http.StatusUnauthorized, map[string]interface{}{
-				"error": "invalid token",
-			})
-		} else {
-			c.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"error": "can't connect to redis server",
-			})
+			if session {
+				h.clearSessionCookie(c)
+			}
+			h.deny(c, "invalid token")
+			return
 		}
-		c.Abort()
+		// can't connect to redis
+		apperror.Abort(c, apperror.Unavailable(err))
+		return
+	}
+
+	grant, err := parseGrant(value)
+	if err != nil {
+		h.Audit.RecordDenied(c, audit.Event{Action: "auth.denied", Target: c.Request.Method + " " + c.Request.URL.Path, Detail: "invalid token"})
+		apperror.Abort(c, apperror.Wrap(err, apperror.CodeUnauthorized, "invalid token"))
 		return
 	}
 
+	// session tokens only come from the cookie, where csrf checks apply
+	if grant.Session != session {
+		h.deny(c, "invalid token")
+		return
+	}
+	if session {
+		active, err := h.slide(c.Request.Context(), token, grant)
+		if err != nil {
+			apperror.Abort(c, apperror.Unavailable(err))
+			return
+		}
+		if !active {
+			h.clearSessionCookie(c)
+			h.deny(c, "session expired")
+			return
+		}
+	}
+
 	// set user id of the authenticated user to context
-	c.Set("uid", uid)
+	c.Set("uid", grant.UID)
+	if grant.ClientID != "" {
+		c.Set("client_id", grant.ClientID)
+		c.Set("scopes", grant.Scopes)
+	}
+}
+
+// deny records the request refused with a token and aborts it as
+// unauthorized
+func (h *Handler) deny(c *gin.Context, reason string) {
+	h.Audit.RecordDenied(c, audit.Event{
+		Action: "auth.denied",
+		Target: c.Request.Method + " " + c.Request.URL.Path,
+		Detail: reason,
+	})
+	apperror.Abort(c, apperror.Unauthorized(reason))
+}
+
+// target names user uid in audit entries
+func target(uid uint) string {
+	return "users/" + strconv.Itoa(int(uid))
 }
@@ -0,0 +1,367 @@
+package user_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/audit"
+	"example.com/social-gin/oauth"
+	"example.com/social-gin/oidc"
+	"example.com/social-gin/post"
+	"example.com/social-gin/user"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// server serves users with their posts on sqlite and miniredis
+type server struct {
+	h     *user.Handler
+	db    *gorm.DB
+	redis *miniredis.Miniredis
+	r     *gin.Engine
+}
+
+func setup(t *testing.T) *server {
+	// foreign keys on, like the production database
+	db, err := gorm.Open(sqlite.Open("file::memory:?_foreign_keys=on"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&user.User{}, &post.Post{}, &oidc.Identity{}, &oauth.Client{}, &oauth.Consent{}); err != nil {
+		t.Fatal(err)
+	}
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	h := &user.Handler{
+		DB:          db,
+		RedisClient: client,
+		Dependents: []user.Dependent{
+			&post.Handler{DB: db},
+			&oidc.Handler{DB: db},
+			&oauth.Handler{DB: db, RedisClient: client},
+		},
+		RestoreGrace: time.Hour,
+		TokenTTL:     10 * time.Minute,
+	}
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.POST("/login", h.LogIn)
+	r.POST("/logout", h.LogOut)
+	r.POST("/users/:uid/restore", h.RestoreUser)
+	g := r.Group("", h.Authorize)
+	g.GET("/me", func(c *gin.Context) { c.String(http.StatusOK, c.GetString("uid")) })
+	g.DELETE("/users/:uid", h.DeleteUser)
+	return &server{h: h, db: db, redis: mr, r: r}
+}
+
+func (s *server) do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.r.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *server) form(path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// bearer sends a request authorized by token
+func (s *server) bearer(method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return s.do(req)
+}
+
+// create adds user blink with a post
+func (s *server) create(t *testing.T) user.User {
+	u := user.User{Username: "blink", Password: "password", Email: "blink@example.com"}
+	if err := s.db.Create(&u).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(&post.Post{UserID: int(u.ID), Content: "hello"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func (s *server) login(t *testing.T) string {
+	rec := s.form("/login", url.Values{"u": {"blink"}, "p": {"password"}})
+	if rec.Code != http.StatusOK {
+		t.Fatal("login want 200 but get", rec.Code, rec.Body.String())
+	}
+	resp := struct {
+		Token string `json:"token"`
+	}{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp.Token
+}
+
+func (s *server) count(model interface{}, unscoped bool) int64 {
+	db := s.db
+	if unscoped {
+		db = db.Unscoped()
+	}
+	var n int64
+	db.Model(model).Count(&n)
+	return n
+}
+
+func TestDeleteRevokesTokens(t *testing.T) {
+	s := setup(t)
+	s.create(t)
+	first, second := s.login(t), s.login(t)
+
+	if rec := s.bearer(http.MethodDelete, "/users/1", first); rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	if n := s.count(&post.Post{}, false); n != 0 {
+		t.Error("given deleted user want posts in the trash but get", n, "live posts")
+	}
+	if rec := s.bearer(http.MethodGet, "/me", second); rec.Code != http.StatusUnauthorized {
+		t.Error("given deleted user want other tokens revoked but get", rec.Code)
+	}
+}
+
+func TestLoginTokenTTL(t *testing.T) {
+	s := setup(t)
+	s.create(t)
+	if ttl := s.redis.TTL(s.login(t)); ttl != 10*time.Minute {
+		t.Error("want token ttl 10m but get", ttl)
+	}
+
+	s.h.GetTokenTTL = func() time.Duration { return time.Hour }
+	if got := s.redis.TTL(s.login(t)); got != time.Hour {
+		t.Error("given reloaded ttl 1h want token ttl 1h but get", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := setup(t)
+	s.create(t)
+	s.bearer(http.MethodDelete, "/users/1", s.login(t))
+
+	rec := s.form("/users/1/restore", url.Values{"u": {"blink"}, "p": {"wrong"}})
+	if rec.Code != http.StatusUnauthorized {
+		t.Error("given wrong password want 401 but get", rec.Code)
+	}
+	rec = s.form("/users/1/restore", url.Values{"u": {"blink"}, "p": {"password"}})
+	if rec.Code != http.StatusOK {
+		t.Fatal("want 200 but get", rec.Code, rec.Body.String())
+	}
+	if s.count(&user.User{}, false) != 1 || s.count(&post.Post{}, false) != 1 {
+		t.Error("given restore want user and its post back")
+	}
+	s.login(t)
+
+	// past the grace period the user stays deleted
+	s.bearer(http.MethodDelete, "/users/1", s.login(t))
+	s.db.Unscoped().Model(&user.User{}).Where("id = 1").Update("deleted_at", time.Now().Add(-2*time.Hour))
+	rec = s.form("/users/1/restore", url.Values{"u": {"blink"}, "p": {"password"}})
+	if rec.Code != http.StatusGone {
+		t.Error("given deleted past grace want 410 but get", rec.Code)
+	}
+}
+
+func TestPermanentDeleteOfTrashedUser(t *testing.T) {
+	s := setup(t)
+	s.create(t)
+	token := s.login(t)
+	s.db.Delete(&user.User{}, 1)
+
+	// a token issued before the user was trashed outside the api
+	rec := s.bearer(http.MethodDelete, "/users/1?permanent=true", token)
+	if rec.Code != http.StatusOK {
+		t.Fatal("given trashed user want permanent delete 200 but get", rec.Code, rec.Body.String())
+	}
+	if s.count(&user.User{}, true) != 0 || s.count(&post.Post{}, true) != 0 {
+		t.Error("given permanent delete want user and posts gone")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := setup(t)
+	old := s.create(t)
+	recent := user.User{Username: "pink", Password: "password", Email: "pink@example.com"}
+	s.db.Create(&recent)
+	s.db.Unscoped().Model(&old).Update("deleted_at", time.Now().Add(-48*time.Hour))
+	s.db.Unscoped().Model(&post.Post{}).Where("user_id = ?", old.ID).Update("deleted_at", time.Now().Add(-48*time.Hour))
+	s.db.Delete(&recent)
+
+	n, err := s.h.Purge(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Error("given one user deleted past retention want 1 purged but get", n)
+	}
+	if s.count(&user.User{}, true) != 1 || s.count(&post.Post{}, true) != 0 {
+		t.Error("want only the recently deleted user kept")
+	}
+}
+
+// failing can't purge the rows of uid
+type failing struct {
+	uid uint
+}
+
+func (f failing) SoftDeleteOwned(tx *gorm.DB, uid uint, at time.Time) error { return nil }
+func (f failing) RestoreOwned(tx *gorm.DB, uid uint, at time.Time) error    { return nil }
+func (f failing) PurgeOwned(tx *gorm.DB, uid uint) error {
+	if uid == f.uid {
+		return errors.New("can't purge")
+	}
+	return nil
+}
+
+func TestPurgeOwned(t *testing.T) {
+	s := setup(t)
+	old := s.create(t)
+	other := user.User{Username: "pink", Password: "password", Email: "pink@example.com"}
+	s.db.Create(&other)
+	s.db.Create(&oidc.Identity{Issuer: "https://accounts.example.com", Subject: "1", UserID: old.ID})
+	s.db.Create(&oauth.Client{ClientID: "app", OwnerID: int(old.ID)})
+	s.db.Create(&oauth.Consent{UserID: int(other.ID), ClientID: "app"})
+	s.redis.SAdd("oauth:tokens:2:app", "issued")
+	s.redis.Set("issued", "{}")
+	stuck := user.User{Username: "stuck", Password: "password", Email: "stuck@example.com"}
+	s.db.Create(&stuck)
+	s.h.Dependents = append(s.h.Dependents, failing{uid: stuck.ID})
+
+	s.bearer(http.MethodDelete, "/users/1", s.login(t))
+	s.db.Delete(&stuck)
+	n, err := s.h.Purge(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Error("given one user failing to purge want the other purged but get", n)
+	}
+	if s.count(&user.User{}, true) != 2 || s.count(&oidc.Identity{}, true) != 0 {
+		t.Error("want blink purged with its identity and stuck kept for the next run")
+	}
+	if s.count(&oauth.Client{}, true) != 0 || s.count(&oauth.Consent{}, true) != 0 || s.redis.Exists("issued") {
+		t.Error("want clients of blink purged with the consents and tokens of other users")
+	}
+}
+
+func TestPermanentDeleteWithIdentity(t *testing.T) {
+	s := setup(t)
+	s.create(t)
+	s.db.Create(&oidc.Identity{Issuer: "https://accounts.example.com", Subject: "1", UserID: 1})
+
+	if rec := s.bearer(http.MethodDelete, "/users/1?permanent=true", s.login(t)); rec.Code != http.StatusOK {
+		t.Fatal("given user linked to an identity want 200 but get", rec.Code, rec.Body.String())
+	}
+	if s.count(&user.User{}, true) != 0 || s.count(&oidc.Identity{}, true) != 0 {
+		t.Error("want user and identity gone")
+	}
+}
+
+func TestRestoreFailureAudited(t *testing.T) {
+	s := setup(t)
+	s.audit(t)
+	s.create(t)
+	s.bearer(http.MethodDelete, "/users/1", s.login(t))
+
+	if rec := s.form("/users/1/restore", url.Values{"u": {"blink"}, "p": {"guess"}}); rec.Code != http.StatusUnauthorized {
+		t.Error("given wrong password want 401 but get", rec.Code)
+	}
+	if entries := s.entries("user.restore_failed", 1); len(entries) != 1 || entries[0].Target != "users/1" {
+		t.Error("want failed restore of users/1 audited but get", entries)
+	}
+}
+
+func TestAddUserListsEveryProblem(t *testing.T) {
+	s := setup(t)
+	s.create(t)
+	s.r.POST("/users", s.h.AddUser)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"username":"blink","password":"short","email":"blink"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := s.do(req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatal("want 422 but get", rec.Code, rec.Body.String())
+	}
+	problem := apperror.Problem{}
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	codes := map[string]string{}
+	for _, fe := range problem.Errors {
+		codes[fe.Field] = fe.Code
+	}
+	want := map[string]string{"username": "unique", "password": "min", "email": "email"}
+	if len(codes) != len(want) || len(problem.Errors) != len(want) {
+		t.Error("want", want, "but get", problem.Errors)
+	}
+	for field, code := range want {
+		if codes[field] != code {
+			t.Error("want", field, code, "but get", codes[field])
+		}
+	}
+}
+
+// audit records to the trail, denials included
+func (s *server) audit(t *testing.T) {
+	if err := s.db.AutoMigrate(&audit.Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	trail := &audit.Trail{DB: s.db}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := trail.Start(ctx, zap.NewNop())
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	s.h.Audit = trail
+}
+
+// entries waits for the denials queued to be recorded, returning the
+// entries of action
+func (s *server) entries(action string, want int) []audit.Entry {
+	entries := []audit.Entry{}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(entries) < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		s.db.Where("action = ?", action).Find(&entries)
+	}
+	// and for none more
+	time.Sleep(50 * time.Millisecond)
+	s.db.Where("action = ?", action).Find(&entries)
+	return entries
+}
+
+func TestAuthorizeAuditsInvalidTokens(t *testing.T) {
+	s := setup(t)
+	s.audit(t)
+
+	if rec := s.do(httptest.NewRequest(http.MethodGet, "/me", nil)); rec.Code != http.StatusUnauthorized {
+		t.Error("given no token want 401 but get", rec.Code)
+	}
+	if rec := s.bearer(http.MethodGet, "/me", "forged"); rec.Code != http.StatusUnauthorized {
+		t.Error("given unknown token want 401 but get", rec.Code)
+	}
+
+	entries := s.entries("auth.denied", 1)
+	if len(entries) != 1 || entries[0].Detail != "invalid token" {
+		t.Error("want only the unknown token audited but get", entries)
+	}
+}
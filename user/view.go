@@ -0,0 +1,61 @@
+package user
+
+import (
+	"time"
+
+	"example.com/social-gin/apiversion"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserV2 represents user data in api v2, which never shows the password
+// and fixes the updated_at name
+type UserV2 struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+}
+
+// NewUserV2 converts user to its api v2 representation
+func NewUserV2(u User) UserV2 {
+	return UserV2{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Username:  u.Username,
+		Name:      u.Name,
+		Email:     u.Email,
+	}
+}
+
+// Profile is the data export source of the user, in the v2 representation
+// so the archive never holds the password
+func Profile(db *gorm.DB, uid uint) (interface{}, error) {
+	u := User{}
+	if err := db.First(&u, uid).Error; err != nil {
+		return nil, err
+	}
+	return NewUserV2(u), nil
+}
+
+// view returns user in the representation of the request api version
+func view(c *gin.Context, u User) interface{} {
+	if apiversion.Get(c) >= 2 {
+		return NewUserV2(u)
+	}
+	return u
+}
+
+func viewList(c *gin.Context, users []User) interface{} {
+	if apiversion.Get(c) >= 2 {
+		v := make([]UserV2, 0, len(users))
+		for _, u := range users {
+			v = append(v, NewUserV2(u))
+		}
+		return v
+	}
+	return users
+}
@@ -0,0 +1,163 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"example.com/social-gin/apperror"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// messages explains each rule, %s is the field and %v the rule parameter
+var messages = map[string]string{
+	"required": "%s is required",
+	"email":    "%s must be a valid email address",
+	"username": "%s may only contain letters, digits, '.', '_' and '-'",
+	"password": "%s must contain at least one letter and one digit",
+	"unique":   "%s is already taken",
+}
+
+func init() {
+	v := binding.Validator.Engine().(*validator.Validate)
+
+	// report fields by their json name
+	v.RegisterTagNameFunc(jsonName)
+
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		var letter, digit bool
+		for _, r := range fl.Field().String() {
+			letter = letter || unicode.IsLetter(r)
+			digit = digit || unicode.IsDigit(r)
+		}
+		return letter && digit
+	})
+}
+
+// Bind binds the request body into obj and validates it, returning 400 for
+// unreadable bodies and 422 listing every invalid field otherwise
+func Bind(c *gin.Context, obj interface{}) error {
+	err := c.ShouldBind(obj)
+	if err == nil {
+		return nil
+	}
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return apperror.Wrap(err, apperror.CodeBadRequest, "invalid request body")
+	}
+	return fromValidator(errs)
+}
+
+// Invalid returns the invalid fields listed by err, ok is false when err
+// isn't about invalid fields
+func Invalid(err error) (fields []apperror.FieldError, ok bool) {
+	var e *apperror.Error
+	if !errors.As(err, &e) || e.Code != apperror.CodeValidation {
+		return nil, false
+	}
+	return e.Fields, true
+}
+
+// Merge adds fields found invalid by other checks, like uniqueness, to err
+// from Bind so one response lists them all. Other errors are returned as
+// they are.
+func Merge(err error, fields ...apperror.FieldError) error {
+	if err == nil {
+		if len(fields) == 0 {
+			return nil
+		}
+		return apperror.Validation(fields...)
+	}
+	invalid, ok := Invalid(err)
+	if !ok {
+		return err
+	}
+	return apperror.Validation(append(invalid[:len(invalid):len(invalid)], fields...)...)
+}
+
+// Partial validates only the fields of obj with the given json names
+func Partial(obj interface{}, fields []string) error {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		for _, field := range fields {
+			if jsonName(f) == field {
+				names = append(names, f.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	v := binding.Validator.Engine().(*validator.Validate)
+	err := v.StructPartial(obj, names...)
+	var errs validator.ValidationErrors
+	if errors.As(err, &errs) {
+		return fromValidator(errs)
+	}
+	return err
+}
+
+func fromValidator(errs validator.ValidationErrors) error {
+	fields := make([]apperror.FieldError, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, Field(fe.Field(), fe.Tag(), message(fe)))
+	}
+	return apperror.Validation(fields...)
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+// Field creates field error for rule, using the standard message when
+// message is empty
+func Field(field, rule, message string) apperror.FieldError {
+	if message == "" {
+		message = fmt.Sprintf(messages[rule], field)
+	}
+	return apperror.FieldError{
+		Field:   field,
+		Code:    rule,
+		Message: message,
+	}
+}
+
+func message(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+
+	switch fe.Tag() {
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s%s", fe.Field(), fe.Param(), unit)
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s%s", fe.Field(), fe.Param(), unit)
+	}
+	if m, ok := messages[fe.Tag()]; ok {
+		return fmt.Sprintf(m, fe.Field())
+	}
+	return fmt.Sprintf("%s is invalid", fe.Field())
+}
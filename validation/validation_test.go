@@ -0,0 +1,106 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/social-gin/apperror"
+	"example.com/social-gin/validation"
+	"github.com/gin-gonic/gin"
+)
+
+type signup struct {
+	Username string `json:"username" binding:"required,min=3,max=32,username"`
+	Password string `json:"password" binding:"required,min=8,password"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+func post(body string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(apperror.Middleware)
+	r.POST("/signup", func(c *gin.Context) {
+		req := signup{}
+		if err := validation.Bind(c, &req); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBindValid(t *testing.T) {
+	rec := post(`{"username":"blink","password":"passw0rd","email":"blink@email.com"}`)
+
+	if rec.Code != http.StatusOK {
+		t.Error("status code is not ok", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBindInvalidFields(t *testing.T) {
+	given := `{"username":"b!","password":"password","email":"not-an-email"}`
+	rec := post(given)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Error("given", given, "want status", http.StatusUnprocessableEntity, "but get", rec.Code)
+		return
+	}
+
+	problem := apperror.Problem{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Error("can't unmarshal response", rec.Body.String())
+		return
+	}
+
+	want := map[string]string{
+		"username": "min",
+		"password": "password",
+		"email":    "email",
+	}
+	if len(problem.Errors) != len(want) {
+		t.Error("given", given, "want", len(want), "field errors but get", problem.Errors)
+	}
+	for _, fe := range problem.Errors {
+		if want[fe.Field] != fe.Code {
+			t.Error("given", given, "want field", fe.Field, "code", want[fe.Field], "but get", fe.Code)
+		}
+		if !strings.HasPrefix(fe.Message, fe.Field+" ") {
+			t.Error("want message about", fe.Field, "but get", fe.Message)
+		}
+	}
+}
+
+func TestBindMalformedBody(t *testing.T) {
+	rec := post(`{"username":`)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Error("want status", http.StatusBadRequest, "but get", rec.Code)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	taken := validation.Field("username", "unique", "")
+
+	err := validation.Merge(apperror.Validation(validation.Field("email", "email", "")), taken)
+	if fields, ok := validation.Invalid(err); !ok || len(fields) != 2 || fields[1].Code != "unique" {
+		t.Error("given invalid email and taken username want both fields but get", err)
+	}
+	if fields, ok := validation.Invalid(validation.Merge(nil, taken)); !ok || len(fields) != 1 {
+		t.Error("given only taken username want it alone but get", fields)
+	}
+	if err := validation.Merge(nil); err != nil {
+		t.Error("given nothing invalid want nil but get", err)
+	}
+	malformed := apperror.BadRequest("invalid request body")
+	if err := validation.Merge(malformed, taken); err != malformed {
+		t.Error("given malformed body want its error unchanged but get", err)
+	}
+}